@@ -0,0 +1,63 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// AnalysisType is the level of NEPA analysis, and the decision document
+// that goes with it, parsed out of the SOPA decision column
+type AnalysisType string
+
+const (
+	AnalysisUnknown      AnalysisType = ""
+	AnalysisCE           AnalysisType = "ce_dm"       // Categorical Exclusion, Decision Memo
+	AnalysisEA           AnalysisType = "ea_dn_fonsi" // Environmental Assessment, Decision Notice and FONSI
+	AnalysisEIS          AnalysisType = "eis_rod"     // Environmental Impact Statement, Record of Decision
+	AnalysisSupplemental AnalysisType = "supplemental"
+)
+
+// analysisPatterns are checked in order, since a supplement also
+// names the kind of analysis it supplements
+var analysisPatterns = []struct {
+	pattern  *regexp.Regexp
+	analysis AnalysisType
+}{
+	{regexp.MustCompile(`\b(supplement(al)?|seis|sir)\b`), AnalysisSupplemental},
+	{regexp.MustCompile(`\b(eis|environmental impact statement|rod|record of decision)\b`), AnalysisEIS},
+	{regexp.MustCompile(`\b(ea|environmental assessment|fonsi|finding of no significant impact|dn|decision notice)\b`), AnalysisEA},
+	{regexp.MustCompile(`\b(ce|categorical(ly)? exclu(sion|ded)|dm|decision memo)\b`), AnalysisCE},
+}
+
+var (
+	notObjectionPattern = regexp.MustCompile(`\bnot (subject to|eligible for) (the )?(pre-?decisional )?objection`)
+	objectionPattern    = regexp.MustCompile(`\bobjection\b|\b36 cfr 218\b`)
+)
+
+// parseAnalysisType reads the analysis type from the decision column
+func parseAnalysisType(decision string) AnalysisType {
+	lower := strings.ToLower(decision)
+	for _, ap := range analysisPatterns {
+		if ap.pattern.MatchString(lower) {
+			return ap.analysis
+		}
+	}
+	return AnalysisUnknown
+}
+
+// parseObjectionEligible is whether the decision can be objected to,
+// or nil when the decision column doesn't say. Categorical exclusions
+// aren't subject to the objection process, so they never are.
+func parseObjectionEligible(decision string, analysis AnalysisType) *bool {
+	lower := strings.ToLower(decision)
+	eligible := false
+	switch {
+	case notObjectionPattern.MatchString(lower):
+	case objectionPattern.MatchString(lower):
+		eligible = true
+	case analysis == AnalysisCE:
+	default:
+		return nil
+	}
+	return &eligible
+}
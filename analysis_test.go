@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParseAnalysisType(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		decision          string
+		analysis          AnalysisType
+		objectionEligible *bool
+	}{
+		{"Decision Memo", AnalysisCE, &no},
+		{"Categorical Exclusion - Decision Memo", AnalysisCE, &no},
+		{"Environmental Assessment - Decision Notice", AnalysisEA, nil},
+		{"Decision Notice, subject to objection", AnalysisEA, &yes},
+		{"EA - not subject to objection", AnalysisEA, &no},
+		{"EIS - Record of Decision", AnalysisEIS, nil},
+		{"Supplemental EIS", AnalysisSupplemental, nil},
+		{"Letter", AnalysisUnknown, nil},
+		{"", AnalysisUnknown, nil},
+	}
+
+	for _, test := range tests {
+		analysis := parseAnalysisType(test.decision)
+		if analysis != test.analysis {
+			t.Errorf("parseAnalysisType(%q) = %q, want %q", test.decision, analysis, test.analysis)
+		}
+
+		eligible := parseObjectionEligible(test.decision, analysis)
+		switch {
+		case eligible == nil && test.objectionEligible == nil:
+		case eligible == nil || test.objectionEligible == nil || *eligible != *test.objectionEligible:
+			t.Errorf("parseObjectionEligible(%q) = %v, want %v", test.decision, describeBool(eligible), describeBool(test.objectionEligible))
+		}
+	}
+}
+
+func describeBool(b *bool) string {
+	if b == nil {
+		return "nil"
+	} else if *b {
+		return "true"
+	}
+	return "false"
+}
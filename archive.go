@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+type ArchiveConfig struct {
+	Record string `help:"Save every response fetched to this archive directory" type:"path" placeholder:"DIR"`
+	Replay string `help:"Serve responses from this archive directory instead of the network" type:"path" placeholder:"DIR"`
+}
+
+// ErrNotRecorded is returned in replay mode for urls missing from the archive
+var ErrNotRecorded = errors.New("not in replay archive")
+
+// recordResponse saves what Get is about to hand back to the caller.
+// Successful responses are saved with their body, failed ones with just
+// their status so a replay fails the same way. Network errors aren't saved.
+func (f *Fetcher) recordResponse(url string, res *http.Response, err error) (*http.Response, error) {
+	var entry *cachedResponse
+	var statusErr *StatusError
+	if err == nil {
+		var readErr error
+		entry, readErr = readResponse(url, res)
+		if readErr != nil {
+			return nil, &FetchError{Url: url, Attempts: 1, Err: readErr}
+		}
+		res = entry.Response()
+	} else if errors.As(err, &statusErr) {
+		entry = &cachedResponse{
+			Url:        url,
+			StatusCode: statusErr.StatusCode,
+			Header:     http.Header{},
+		}
+	} else {
+		return res, err
+	}
+
+	if saveErr := f.record.Save(entry); saveErr != nil {
+		return nil, &FetchError{Url: url, Attempts: 1, Err: saveErr}
+	}
+	return res, err
+}
+
+// replayResponse serves url from the archive, failing
+// with the recorded status if the original request failed
+func (f *Fetcher) replayResponse(url string) (*http.Response, error) {
+	entry, err := f.replay.Load(url)
+	if err != nil {
+		return nil, &FetchError{Url: url, Err: err}
+	} else if entry == nil {
+		return nil, &FetchError{Url: url, Err: ErrNotRecorded}
+	}
+
+	if entry.StatusCode < 200 || entry.StatusCode > 299 {
+		return nil, &FetchError{Url: url, Attempts: 1, Err: &StatusError{
+			Url:        url,
+			StatusCode: entry.StatusCode,
+			Status:     entry.Response().Status,
+		}}
+	}
+	return entry.Response(), nil
+}
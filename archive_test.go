@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	server, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/forest":
+			w.Write([]byte("forest page"))
+		case "/report":
+			w.Write([]byte("report page"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	dir := t.TempDir()
+	recorder := newTestFetcher(t, CrawlConfig{MaxAttempts: 1, ArchiveConfig: ArchiveConfig{Record: dir}})
+
+	urls := map[string]string{
+		server.URL + "/forest": "forest page",
+		server.URL + "/report": "report page",
+	}
+	for url, want := range urls {
+		if _, got := getBody(t, recorder, url); got != want {
+			t.Fatalf("recorded %s = %q, want %q", url, got, want)
+		}
+	}
+	if _, err := recorder.Get(context.Background(), server.URL+"/gone"); err == nil {
+		t.Fatal("recording a 404 succeeded")
+	}
+
+	// everything replayed now comes from the archive
+	server.Close()
+	replayer := newTestFetcher(t, CrawlConfig{ArchiveConfig: ArchiveConfig{Replay: dir}})
+
+	for url, want := range urls {
+		status, got := getBody(t, replayer, url)
+		if status != http.StatusOK || got != want {
+			t.Errorf("replayed %s = %d %q, want 200 %q", url, status, got, want)
+		}
+	}
+
+	_, err := replayer.Get(context.Background(), server.URL+"/gone")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("replayed /gone err = %v, want the recorded 404", err)
+	}
+
+	_, err = replayer.Get(context.Background(), server.URL+"/never-fetched")
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("replay miss err = %v, want ErrNotRecorded", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type CacheConfig struct {
+	CacheDir string        `help:"Directory for the on-disk response cache, empty disables the cache" type:"path"`
+	CacheTtl time.Duration `help:"Serve cached responses younger than this without revalidating" default:"6h"`
+	Offline  bool          `help:"Serve only from the response cache, never touch the network"`
+}
+
+// ErrNotCached is returned in offline mode for urls missing from the cache
+var ErrNotCached = errors.New("not in response cache")
+
+// cachedResponse is a response saved to disk. The metadata is
+// stored as <key>.json and the body next to it as <key>.body
+type cachedResponse struct {
+	Url        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	FetchedAt  time.Time   `json:"fetched_at"`
+
+	body []byte
+}
+
+// Response rebuilds an *http.Response serving the saved body
+func (entry *cachedResponse) Response() *http.Response {
+	return &http.Response{
+		StatusCode:    entry.StatusCode,
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		Header:        entry.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.body)),
+		ContentLength: int64(len(entry.body)),
+	}
+}
+
+// conditionalHeader asks the server to only send the body if it changed
+func (entry *cachedResponse) conditionalHeader() http.Header {
+	header := http.Header{}
+	if entry == nil {
+		return header
+	}
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	return header
+}
+
+// responseStore keeps responses on disk keyed by url
+type responseStore struct {
+	dir string
+}
+
+func newResponseStore(dir string) (*responseStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &responseStore{dir: dir}, nil
+}
+
+func (store *responseStore) path(url string, ext string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(store.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// Load returns the saved response for url, or nil if there is none
+func (store *responseStore) Load(url string) (*cachedResponse, error) {
+	meta, err := ioutil.ReadFile(store.path(url, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry := &cachedResponse{}
+	if err := json.Unmarshal(meta, entry); err != nil {
+		return nil, err
+	}
+
+	entry.body, err = ioutil.ReadFile(store.path(url, ".body"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// Save writes the entry to disk. Files are written to a temp file and
+// renamed into place so concurrent readers never see half an entry.
+func (store *responseStore) Save(entry *cachedResponse) error {
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(store.path(entry.Url, ".body"), entry.body); err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path(entry.Url, ".json"), meta)
+}
+
+// readResponse consumes and closes res.Body and turns it into an entry
+func readResponse(url string, res *http.Response) (*cachedResponse, error) {
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedResponse{
+		Url:        url,
+		StatusCode: res.StatusCode,
+		Header:     res.Header.Clone(),
+		FetchedAt:  time.Now().UTC(),
+		body:       body,
+	}, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileAtomicWith(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomicWith is writeFileAtomic for content that's streamed out by write
+func writeFileAtomicWith(path string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getBody(t *testing.T, fetcher *Fetcher, url string) (int, string) {
+	t.Helper()
+	res, err := fetcher.Get(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	const lastModified = "Mon, 03 Jan 2022 10:00:00 GMT"
+	var conditional, unchanged int32
+	body := "first edition"
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&conditional, 1)
+			if atomic.LoadInt32(&unchanged) == 1 {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(body))
+	})
+	fetcher := newTestFetcher(t, CrawlConfig{CacheConfig: CacheConfig{CacheDir: t.TempDir()}})
+
+	if _, got := getBody(t, fetcher, server.URL); got != body {
+		t.Fatalf("body = %q, want %q", got, body)
+	}
+
+	// a 304 serves the cached body
+	atomic.StoreInt32(&unchanged, 1)
+	status, got := getBody(t, fetcher, server.URL)
+	if status != http.StatusOK || got != "first edition" {
+		t.Errorf("after a 304 got %d %q, want the cached 200 %q", status, got, "first edition")
+	}
+	if n := atomic.LoadInt32(&conditional); n != 1 {
+		t.Errorf("server saw %d conditional requests, want 1", n)
+	}
+
+	// a changed page replaces the cached one
+	atomic.StoreInt32(&unchanged, 0)
+	body = "second edition"
+	if _, got := getBody(t, fetcher, server.URL); got != body {
+		t.Errorf("body = %q, want the changed %q", got, body)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+}
+
+func TestCacheTtl(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("report"))
+	})
+	fetcher := newTestFetcher(t, CrawlConfig{CacheConfig: CacheConfig{CacheDir: t.TempDir(), CacheTtl: time.Hour}})
+
+	for i := 0; i < 3; i++ {
+		if _, got := getBody(t, fetcher, server.URL); got != "report" {
+			t.Fatalf("body = %q, want %q", got, "report")
+		}
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("server saw %d requests, want 1 with the rest fresh in the cache", n)
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("report"))
+	})
+	dir := t.TempDir()
+	online := newTestFetcher(t, CrawlConfig{CacheConfig: CacheConfig{CacheDir: dir}})
+	getBody(t, online, server.URL+"/cached")
+
+	offline := newTestFetcher(t, CrawlConfig{CacheConfig: CacheConfig{CacheDir: dir, Offline: true}})
+	if _, got := getBody(t, offline, server.URL+"/cached"); got != "report" {
+		t.Errorf("offline body = %q, want the cached %q", got, "report")
+	}
+
+	_, err := offline.Get(context.Background(), server.URL+"/missing")
+	if !errors.Is(err, ErrNotCached) {
+		t.Errorf("offline cache miss err = %v, want ErrNotCached", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("server saw %d requests, want only the one made online", n)
+	}
+
+	if _, err := NewFetcher(CrawlConfig{RequestTimeout: time.Second, CacheConfig: CacheConfig{Offline: true}}); err == nil {
+		t.Errorf("NewFetcher accepted --offline without a cache directory")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ChangeSet is what one parse-updates run changed, relative to the state
+// it started from. The current state is the latest snapshot with every
+// change set based on it applied in order.
+type ChangeSet struct {
+	Id            string         `json:"id"`
+	SchemaVersion int            `json:"schema_version"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	ToolVersion   string         `json:"tool_version"`
+	BaseSnapshot  string         `json:"base_snapshot"`
+	Forests       []ForestChange `json:"forests"`
+}
+
+// ForestChange is the changes to one forest. A forest new to the data
+// set is carried whole in Forest. RemovedProjects are the projects listed
+// in the edition before the newest report ingested but not in it, they
+// stay in the data set with their history.
+type ForestChange struct {
+	ForestId        int             `json:"forest_id"`
+	ForestName      string          `json:"forest_name"`
+	Reports         []string        `json:"reports,omitempty"`
+	Forest          *Forest         `json:"forest,omitempty"`
+	AddedProjects   []Project       `json:"added_projects,omitempty"`
+	ChangedProjects []ProjectChange `json:"changed_projects,omitempty"`
+	RemovedProjects []string        `json:"removed_projects,omitempty"`
+	ParseIssues     []ParseIssue    `json:"parse_issues,omitempty"`
+}
+
+// ProjectChange is the snapshots added or replaced, and documents added,
+// on an existing project. Fields lists how its newest snapshot changed.
+type ProjectChange struct {
+	Key       string            `json:"key"`
+	Fields    []FieldChange     `json:"fields,omitempty"`
+	Updates   []ProjectUpdate   `json:"updates,omitempty"`
+	Documents []ProjectDocument `json:"documents,omitempty"`
+}
+
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+var changeSetPattern = regexp.MustCompile(`^changes-(\d{4}-\d{2}-\d{2}T\d{6}Z)\.json$`)
+
+// newChangeSetId is the run's time, so change sets sort in the order they were made
+func newChangeSetId(now time.Time) string {
+	return now.UTC().Format("2006-01-02T150405Z")
+}
+
+func changeSetName(id string) string {
+	return "changes-" + id + ".json"
+}
+
+// changeSetId is the id of the change set saved as name,
+// or "" when name isn't a change set
+func changeSetId(name string) string {
+	matches := changeSetPattern.FindStringSubmatch(name)
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// cloneForest deep copies the forest, so it can be
+// diffed against after it's been updated in place
+func cloneForest(forest Forest) (Forest, error) {
+	clone := Forest{}
+	err := remarshal(forest, &clone)
+	return clone, err
+}
+
+// diffForests finds what changed between before and after,
+// with reports listing the SOPA reports ingested for each forest id
+func diffForests(before []Forest, after []Forest, reports map[int][]string) ([]ForestChange, error) {
+	previous := map[int]*Forest{}
+	for i := range before {
+		previous[before[i].Id] = &before[i]
+	}
+
+	changes := []ForestChange{}
+	for i := range after {
+		forest := &after[i]
+		change := ForestChange{
+			ForestId:   forest.Id,
+			ForestName: forest.Name,
+			Reports:    reports[forest.Id],
+		}
+
+		old, ok := previous[forest.Id]
+		if !ok {
+			change.Forest = forest
+			changes = append(changes, change)
+			continue
+		}
+
+		for _, project := range forest.Projects {
+			oldProject := old.Project(project.Key)
+			if oldProject == nil {
+				change.AddedProjects = append(change.AddedProjects, project)
+				continue
+			}
+			projectChange, err := diffProject(*oldProject, project)
+			if err != nil {
+				return nil, err
+			}
+			if len(projectChange.Updates) > 0 || len(projectChange.Documents) > 0 {
+				change.ChangedProjects = append(change.ChangedProjects, projectChange)
+			}
+		}
+		change.RemovedProjects = droppedProjects(*forest, change.Reports)
+		if len(forest.ParseIssues) > len(old.ParseIssues) {
+			change.ParseIssues = forest.ParseIssues[len(old.ParseIssues):]
+		}
+
+		// reports with no projects still have to be recorded as ingested
+		if change.Reports != nil || change.AddedProjects != nil || change.ChangedProjects != nil || change.RemovedProjects != nil || change.ParseIssues != nil {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// droppedProjects is the keys of the projects listed in the edition before
+// the newest of reports, but not in that newest one
+func droppedProjects(forest Forest, reports []string) []string {
+	latest := ""
+	for _, report := range reports {
+		if date := GetSopaReportDateFromURL(report); date > latest {
+			latest = date
+		}
+	}
+	previous := ""
+	for _, date := range forest.SopaReportDates() {
+		if date < latest {
+			previous = date
+		}
+	}
+	if previous == "" {
+		return nil
+	}
+
+	var dropped []string
+	for i := range forest.Projects {
+		project := &forest.Projects[i]
+		if project.Update(previous) != nil && project.Update(latest) == nil {
+			dropped = append(dropped, project.Key)
+		}
+	}
+	return dropped
+}
+
+func diffProject(before Project, after Project) (ProjectChange, error) {
+	change := ProjectChange{Key: after.Key}
+
+	for _, update := range after.Updates {
+		old := before.Update(update.SopaReportDate)
+		if old == nil {
+			change.Updates = append(change.Updates, update)
+			continue
+		}
+		same, err := sameJson(*old, update)
+		if err != nil {
+			return change, err
+		} else if !same {
+			change.Updates = append(change.Updates, update)
+		}
+	}
+
+	have := map[string]bool{}
+	for _, doc := range before.Documents {
+		have[doc.Url] = true
+	}
+	for _, doc := range after.Documents {
+		if !have[doc.Url] {
+			change.Documents = append(change.Documents, doc)
+		}
+	}
+
+	if len(change.Updates) > 0 {
+		fields, err := diffFields(before.Current(), after.Current())
+		if err != nil {
+			return change, err
+		}
+		change.Fields = fields
+	}
+	return change, nil
+}
+
+// diffFields compares the snapshots field by field, as they're saved
+func diffFields(before ProjectUpdate, after ProjectUpdate) ([]FieldChange, error) {
+	var oldFields, newFields map[string]json.RawMessage
+	if err := remarshal(before, &oldFields); err != nil {
+		return nil, err
+	}
+	if err := remarshal(after, &newFields); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range newFields {
+		names = append(names, name)
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fields := []FieldChange{}
+	for _, name := range names {
+		// which edition it came from and how well it matched always change
+		if name == "sopa_report_date" || name == "match_confidence" {
+			continue
+		}
+		if !bytes.Equal(oldFields[name], newFields[name]) {
+			fields = append(fields, FieldChange{Field: name, Old: oldFields[name], New: newFields[name]})
+		}
+	}
+	return fields, nil
+}
+
+func remarshal(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+func sameJson(a interface{}, b interface{}) (bool, error) {
+	aData, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bData, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aData, bData), nil
+}
+
+// Apply brings the data set forward by the change set. Applying
+// one that's already included changes nothing.
+func (changeSet ChangeSet) Apply(dataset *Dataset) {
+	for _, change := range changeSet.Forests {
+		var forest *Forest
+		for i := range dataset.Forests {
+			if dataset.Forests[i].Id == change.ForestId {
+				forest = &dataset.Forests[i]
+			}
+		}
+
+		if change.Forest != nil {
+			if forest != nil {
+				*forest = *change.Forest
+			} else {
+				dataset.Forests = append(dataset.Forests, *change.Forest)
+			}
+			continue
+		} else if forest == nil {
+			continue
+		}
+
+		// removed projects keep their history, they're only no longer listed
+		for _, project := range change.AddedProjects {
+			if existing := forest.Project(project.Key); existing != nil {
+				*existing = project
+			} else {
+				forest.Projects = append(forest.Projects, project)
+			}
+			// a project that got its NEPA id replaces the one under its synthetic id
+			if project.SyntheticId != "" && project.SyntheticId != project.Key {
+				forest.removeProject(project.SyntheticId)
+			}
+		}
+		for _, projectChange := range change.ChangedProjects {
+			project := forest.Project(projectChange.Key)
+			if project == nil {
+				continue
+			}
+			for _, update := range projectChange.Updates {
+				project.AddUpdate(update)
+			}
+			project.AddDocuments(projectChange.Documents)
+		}
+		forest.ParseIssues = appendNewIssues(forest.ParseIssues, change.ParseIssues)
+		for _, report := range change.Reports {
+			forest.AddSopaReport(report)
+		}
+	}
+}
+
+func (forest *Forest) removeProject(key string) {
+	for i := range forest.Projects {
+		if forest.Projects[i].Key == key {
+			forest.Projects = append(forest.Projects[:i], forest.Projects[i+1:]...)
+			return
+		}
+	}
+}
+
+// appendNewIssues skips issues already there, so change sets can be reapplied
+func appendNewIssues(issues []ParseIssue, more []ParseIssue) []ParseIssue {
+	have := map[ParseIssue]bool{}
+	for _, issue := range issues {
+		have[issue] = true
+	}
+	for _, issue := range more {
+		if !have[issue] {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// loadCurrent rebuilds the current state from the store's latest snapshot
+// and the change sets made on top of it. It also returns the snapshot's date.
+func loadCurrent(ctx context.Context, store Store) (Dataset, string, error) {
+	dataset, date, err := store.LoadLatest(ctx)
+	if err != nil {
+		return dataset, date, err
+	}
+
+	ids, err := store.ListChangeSets(ctx)
+	if err != nil {
+		return dataset, date, err
+	}
+
+	// ids are the UTC time they were made, and snapshot dates are local,
+	// so anything from more than a day before the snapshot can't be based
+	// on it and isn't worth loading
+	earliest := ""
+	if taken, err := time.Parse("2006-01-02", date); err == nil {
+		earliest = taken.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	for _, id := range ids {
+		if id < earliest {
+			continue
+		}
+		changeSet, err := store.LoadChangeSet(ctx, id)
+		if err != nil {
+			return dataset, date, err
+		}
+		if changeSet.BaseSnapshot == date {
+			changeSet.Apply(&dataset)
+		}
+	}
+	return dataset, date, nil
+}
+
+// decodeChangeSet reads a change set, refusing ones newer than we understand
+func decodeChangeSet(data []byte) (ChangeSet, error) {
+	changeSet := ChangeSet{}
+	if err := json.Unmarshal(data, &changeSet); err != nil {
+		return changeSet, err
+	}
+	if changeSet.SchemaVersion > datasetSchemaVersion {
+		return changeSet, fmt.Errorf("change set schema version %d is newer than this tool understands (%d)", changeSet.SchemaVersion, datasetSchemaVersion)
+	}
+	return changeSet, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const (
+	testJulyReport    = "https://www.fs.fed.us/sopa/components/reports/sopa-110515-2021-07.html"
+	testJanuaryReport = "https://www.fs.fed.us/sopa/components/reports/sopa-110515-2022-01.html"
+	testAprilReport   = "https://www.fs.fed.us/sopa/components/reports/sopa-110515-2022-04.html"
+)
+
+func testForests() []Forest {
+	sierra := Forest{Name: "Sierra National Forest", Id: 110515}
+	sierra.AddUpdates([]ProjectUpdate{
+		{Name: "Shaver Lake Fuels", Id: "50001", Status: "In Progress", SopaReportDate: "2021-07"},
+		{Name: "Dinkey Creek Trail", District: "High Sierra", SopaReportDate: "2021-07"},
+	})
+	sierra.AddSopaReport(testJulyReport)
+	return []Forest{sierra, {Name: "Sequoia National Forest", Id: 110513}}
+}
+
+func TestChangeSetApply(t *testing.T) {
+	before := testForests()
+	after := testForests()
+
+	sierra := &after[0]
+	keys := sierra.AddUpdates([]ProjectUpdate{
+		{Name: "Shaver Lake Fuels", Id: "50001", Status: "Completed", SopaReportDate: "2022-01"},
+		{Name: "Big Creek Thinning", Id: "50002", SopaReportDate: "2022-01"},
+	})
+	sierra.Project(keys[0]).AddDocuments([]ProjectDocument{{Url: "https://example.com/dm.pdf", Name: "Decision Memo"}})
+	sierra.ParseIssues = append(sierra.ParseIssues, ParseIssue{PageUrl: testJanuaryReport, Field: "location", Reason: "empty location"})
+	sierra.AddSopaReport(testJanuaryReport)
+	// an edition that listed no projects is only recorded as ingested
+	sequoia := &after[1]
+	sequoia.AddSopaReport(testJanuaryReport)
+
+	reports := map[int][]string{
+		sierra.Id:  {testJanuaryReport},
+		sequoia.Id: {testJanuaryReport},
+	}
+	changes, err := diffForests(before, after, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d forest changes, want 2: %+v", len(changes), changes)
+	}
+
+	changed := changes[0].ChangedProjects
+	if len(changed) != 1 || changed[0].Key != "50001" || len(changed[0].Documents) != 1 {
+		t.Errorf("changed projects = %+v, want 50001 with its new snapshot and document", changed)
+	} else if len(changed[0].Fields) != 1 || changed[0].Fields[0].Field != "status" {
+		t.Errorf("changed fields = %+v, want only status", changed[0].Fields)
+	}
+
+	changeSet := ChangeSet{Id: newChangeSetId(time.Now()), Forests: changes}
+	dataset := Dataset{Forests: testForests()}
+	changeSet.Apply(&dataset)
+	assertSameForests(t, "applied", dataset.Forests, after)
+
+	// applying it again changes nothing
+	changeSet.Apply(&dataset)
+	assertSameForests(t, "reapplied", dataset.Forests, after)
+}
+
+func TestLoadCurrent(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore("json")
+	if err := store.Save(ctx, "2022-01-01", newDataset(CrawlConfig{}, ForestFilterConfig{}, testForests())); err != nil {
+		t.Fatal(err)
+	}
+
+	after := testForests()
+	after[0].AddUpdates([]ProjectUpdate{{Name: "Big Creek Thinning", Id: "50002", SopaReportDate: "2022-04"}})
+	after[0].AddSopaReport(testAprilReport)
+	changes, err := diffForests(testForests()[:1], after[:1], map[int][]string{after[0].Id: {testAprilReport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changeSets := []ChangeSet{
+		// older than the snapshot, already in it
+		{Id: "2021-12-01T000000Z", BaseSnapshot: "2021-11-01", Forests: []ForestChange{{ForestId: 110515, RemovedProjects: []string{"50001"}}}},
+		{Id: "2022-04-02T000000Z", BaseSnapshot: "2022-01-01", Forests: changes},
+	}
+	for _, changeSet := range changeSets {
+		if err := store.SaveChangeSet(ctx, changeSet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dataset, date, err := loadCurrent(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date != "2022-01-01" {
+		t.Errorf("date = %q, want the snapshot's", date)
+	}
+	assertSameForests(t, "current", dataset.Forests, after)
+}
+
+func assertSameForests(t *testing.T, what string, got []Forest, want []Forest) {
+	t.Helper()
+	same, err := sameJson(got, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same {
+		t.Errorf("%s forests = %+v, want %+v", what, got, want)
+	}
+}
+
+func TestChangeSetDroppedProject(t *testing.T) {
+	before := testForests()
+	after := testForests()
+
+	// Dinkey Creek Trail isn't in the January edition
+	sierra := &after[0]
+	sierra.AddUpdates([]ProjectUpdate{{Name: "Shaver Lake Fuels", Id: "50001", Status: "In Progress", SopaReportDate: "2022-01"}})
+	sierra.AddSopaReport(testJanuaryReport)
+	dinkey := sierra.Projects[1].Key
+
+	changes, err := diffForests(before[:1], after[:1], map[int][]string{sierra.Id: {testJanuaryReport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || len(changes[0].RemovedProjects) != 1 || changes[0].RemovedProjects[0] != dinkey {
+		t.Fatalf("changes = %+v, want %s removed", changes, dinkey)
+	}
+
+	// it's still in the data set, with its history
+	dataset := Dataset{Forests: testForests()}
+	ChangeSet{Forests: changes}.Apply(&dataset)
+	assertSameForests(t, "applied", dataset.Forests, after)
+	if dataset.Forests[0].Project(dinkey) == nil {
+		t.Errorf("removed project %s was deleted from the data set", dinkey)
+	}
+}
+
+func TestChangeSetUpgradedId(t *testing.T) {
+	before := testForests()
+	after := testForests()
+
+	sierra := &after[0]
+	synthetic := sierra.Projects[1].Key
+	sierra.AddUpdates([]ProjectUpdate{
+		{Name: "Shaver Lake Fuels", Id: "50001", SopaReportDate: "2022-01"},
+		{Name: "Dinkey Creek Trail", Id: "60001", District: "High Sierra", SopaReportDate: "2022-01"},
+	})
+	sierra.AddSopaReport(testJanuaryReport)
+
+	changes, err := diffForests(before[:1], after[:1], map[int][]string{sierra.Id: {testJanuaryReport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].RemovedProjects != nil {
+		t.Fatalf("changes = %+v, want nothing removed when a project gets its NEPA id", changes)
+	}
+
+	dataset := Dataset{Forests: testForests()}
+	ChangeSet{Forests: changes}.Apply(&dataset)
+	assertSameForests(t, "applied", dataset.Forests, after)
+	if dataset.Forests[0].Project(synthetic) != nil {
+		t.Errorf("project still under its synthetic key %s", synthetic)
+	}
+}
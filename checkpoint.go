@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+type CheckpointConfig struct {
+	StateDir string `help:"Directory each finished forest is checkpointed to" default:"data/checkpoint" type:"path"`
+	Resume   bool   `help:"Skip forests already finished in the state directory"`
+}
+
+// checkpoint keeps a crawl's progress on disk, one file per
+// finished forest plus the list of forests the crawl started with
+type checkpoint struct {
+	dir string
+}
+
+func openCheckpoint(dir string) (*checkpoint, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &checkpoint{dir: dir}, nil
+}
+
+// Clear removes a previous crawl's progress so a fresh crawl
+// can't be resumed into stale forests
+func (c *checkpoint) Clear() error {
+	files, err := filepath.Glob(filepath.Join(c.dir, "forest-*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checkpoint) SaveForestList(forests []Forest) error {
+	return c.save("forest-list.json", forests)
+}
+
+// LoadForestList returns nil if no crawl has been started
+func (c *checkpoint) LoadForestList() ([]Forest, error) {
+	forests := []Forest{}
+	found, err := c.load("forest-list.json", &forests)
+	if !found {
+		return nil, err
+	}
+	return forests, err
+}
+
+func (c *checkpoint) SaveForest(forest Forest) error {
+	return c.save(forestCheckpointName(forest), forest)
+}
+
+// LoadForest returns nil if the forest hasn't been finished
+func (c *checkpoint) LoadForest(forest Forest) (*Forest, error) {
+	done := &Forest{}
+	found, err := c.load(forestCheckpointName(forest), done)
+	if !found {
+		return nil, err
+	}
+	return done, err
+}
+
+func (c *checkpoint) save(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, name), data)
+}
+
+func (c *checkpoint) load(name string, v interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// forestCheckpointName uses the forest id, or the state and
+// name for the odd forest whose link had no id
+func forestCheckpointName(forest Forest) string {
+	if forest.Id != 0 {
+		return fmt.Sprintf("forest-%d.json", forest.Id)
+	}
+	return fmt.Sprintf("forest-%s.json", unsafeFileChars.ReplaceAllString(forest.State.Name+"-"+forest.Name, "_"))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFinishCrawlClearsCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	checkpoint, err := openCheckpoint(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forests := testForests()
+	if err := checkpoint.SaveForestList(forests); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.SaveForest(forests[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// saving fails, the checkpoint is kept for --resume
+	config := ParseAllProjectsConfig{Output: filepath.Join(t.TempDir(), "missing", "forests.json")}
+	if err := finishCrawl(ctx, config, newMemoryStore("json"), checkpoint, Dataset{Forests: forests}, 0); err == nil {
+		t.Fatal("finishCrawl succeeded writing into a missing directory")
+	}
+	assertCheckpointed(t, checkpoint, forests[0], true)
+
+	// some forests are incomplete, so it's kept too
+	store := newMemoryStore("json")
+	dataset := newDataset(CrawlConfig{}, ForestFilterConfig{}, forests)
+	if err := finishCrawl(ctx, ParseAllProjectsConfig{}, store, checkpoint, dataset, 1); err != nil {
+		t.Fatal(err)
+	}
+	assertCheckpointed(t, checkpoint, forests[0], true)
+
+	// once everything is saved a later --resume starts over
+	if err := finishCrawl(ctx, ParseAllProjectsConfig{}, store, checkpoint, dataset, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.LoadLatest(ctx); err != nil {
+		t.Fatalf("data set not saved: %v", err)
+	}
+	assertCheckpointed(t, checkpoint, forests[0], false)
+}
+
+func assertCheckpointed(t *testing.T, checkpoint *checkpoint, forest Forest, want bool) {
+	t.Helper()
+	list, err := checkpoint.LoadForestList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := checkpoint.LoadForest(forest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (list != nil) != want || (done != nil) != want {
+		t.Errorf("forest list checkpointed %v, forest %v, want both %v", list != nil, done != nil, want)
+	}
+}
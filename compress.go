@@ -0,0 +1,78 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionNone = ""
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// compressionFor reads the compression from the file extension, falling
+// back to the content encoding S3 reports for the object
+func compressionFor(name string, contentEncoding string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return compressionGzip
+	case strings.HasSuffix(name, ".zst"):
+		return compressionZstd
+	}
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return compressionGzip
+	case "zstd":
+		return compressionZstd
+	}
+	return compressionNone
+}
+
+// isNdjson is whether the file name, less any compression extension, is .ndjson
+func isNdjson(name string) bool {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	return strings.HasSuffix(name, ".ndjson")
+}
+
+func decompress(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case compressionGzip:
+		return gzip.NewReader(r)
+	case compressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case compressionNone:
+		return ioutil.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
+
+// compress wraps w, Close flushes the compressed stream but doesn't close w
+func compress(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case compressionGzip:
+		return gzip.NewWriter(w), nil
+	case compressionZstd:
+		return zstd.NewWriter(w)
+	case compressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+var (
+	contactSeparator = regexp.MustCompile(`(?i)<br\s*/?>|\n`)
+	htmlTag          = regexp.MustCompile(`<[^>]*>`)
+	phoneShape       = regexp.MustCompile(`^[\d\s().+-]{7,}(\s*(x|ext\.?|extension)\s*\d+)?$`)
+)
+
+// parseContacts reads the contact cell, usually a name, phone number and
+// email for each contact, one per line, any of which may be missing. A
+// contact starts at a name, or at a part the current contact already has.
+// The second return lists the parts that couldn't be read, with why.
+func parseContacts(cell string) ([]Contact, [][2]string) {
+	contacts := []Contact{}
+	problems := [][2]string{}
+
+	current := Contact{}
+	flush := func() {
+		if current != (Contact{}) {
+			contacts = append(contacts, current)
+		}
+		current = Contact{}
+	}
+
+	for _, part := range contactSeparator.Split(cell, -1) {
+		part = trim(html.UnescapeString(htmlTag.ReplaceAllString(part, "")))
+		part = strings.TrimPrefix(part, "mailto:")
+		if part == "" {
+			continue
+		}
+
+		switch {
+		case strings.Contains(part, "@"):
+			address, err := mail.ParseAddress(part)
+			if err != nil {
+				problems = append(problems, [2]string{part, "invalid email address"})
+				continue
+			}
+			if current.Email != "" {
+				flush()
+			}
+			current.Email = strings.ToLower(address.Address)
+			if current.Name == "" && address.Name != "" {
+				current.Name = address.Name
+			}
+
+		case phoneShape.MatchString(strings.ToLower(part)):
+			if current.Phone != "" {
+				flush()
+			}
+			// toLower catches more "ext" strings
+			number, err := phonenumbers.Parse(strings.ToLower(part), "US")
+			if err != nil || !phonenumbers.IsValidNumber(number) {
+				problems = append(problems, [2]string{part, "invalid phone number"})
+				current.Phone = part
+				continue
+			}
+			current.Phone = phonenumbers.Format(number, phonenumbers.NATIONAL)
+			current.PhoneE164 = phonenumbers.Format(number, phonenumbers.E164)
+			current.Extension = number.GetExtension()
+
+		default:
+			if current.Name != "" || current.Phone != "" || current.Email != "" {
+				flush()
+			}
+			current.Name = part
+		}
+	}
+	flush()
+
+	return contacts, problems
+}
+
+// PrimaryContact is the first contact listed, for exports
+func (project ProjectUpdate) PrimaryContact() Contact {
+	if len(project.Contacts) == 0 {
+		return Contact{}
+	}
+	return project.Contacts[0]
+}
+
+// UnmarshalJSON also loads data sets saved when a project
+// had a single contact, under "contact"
+func (project *ProjectUpdate) UnmarshalJSON(data []byte) error {
+	type plainProjectUpdate ProjectUpdate
+	var raw struct {
+		plainProjectUpdate
+		Contact *Contact `json:"contact"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*project = ProjectUpdate(raw.plainProjectUpdate)
+	if project.Contacts == nil && raw.Contact != nil && *raw.Contact != (Contact{}) {
+		project.Contacts = []Contact{*raw.Contact}
+	}
+	return nil
+}
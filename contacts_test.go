@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseContacts(t *testing.T) {
+	tests := []struct {
+		cell     string
+		contacts []Contact
+		problems [][2]string
+	}{
+		{"", []Contact{}, [][2]string{}},
+		{
+			cell: "Jane Doe<br/>530-555-0100<br/>jane.doe@usda.gov",
+			contacts: []Contact{
+				{Name: "Jane Doe", Email: "jane.doe@usda.gov", Phone: "(530) 555-0100", PhoneE164: "+15305550100"},
+			},
+			problems: [][2]string{},
+		},
+		{
+			cell: "Jane Doe<br/>530-555-0100 ext. 12<br/>jane.doe@usda.gov<br/>John Roe<br/>John.Roe@usda.gov",
+			contacts: []Contact{
+				{Name: "Jane Doe", Email: "jane.doe@usda.gov", Phone: "(530) 555-0100 ext. 12", PhoneE164: "+15305550100", Extension: "12"},
+				{Name: "John Roe", Email: "john.roe@usda.gov"},
+			},
+			problems: [][2]string{},
+		},
+		{
+			// a bad email is reported, the rest of the contact kept
+			cell:     "Jane Doe<br/>not an email@",
+			contacts: []Contact{{Name: "Jane Doe"}},
+			problems: [][2]string{{"not an email@", "invalid email address"}},
+		},
+	}
+
+	for _, test := range tests {
+		contacts, problems := parseContacts(test.cell)
+		if !reflect.DeepEqual(contacts, test.contacts) {
+			t.Errorf("parseContacts(%q) = %+v, want %+v", test.cell, contacts, test.contacts)
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("parseContacts(%q) problems = %q, want %q", test.cell, problems, test.problems)
+		}
+	}
+}
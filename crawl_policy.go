@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CrawlConfig is the crawl policy shared by every command
+// that talks to the USFS websites
+type CrawlConfig struct {
+	RateLimit      float64       `help:"Max requests per second sent to each host, 0 for no limit" default:"1"`
+	Burst          int           `help:"Requests allowed to each host in a burst before the rate limit applies" default:"2"`
+	UserAgent      string        `help:"User-Agent sent with every request" default:"projectsdb/0.1"`
+	Contact        string        `help:"Contact address added to the User-Agent" default:"https://github.com/Wildfires-org/projectsdb"`
+	RespectRobots  bool          `help:"Skip urls disallowed by the host's robots.txt"`
+	RequestTimeout time.Duration `help:"Timeout for a single request attempt" default:"30s"`
+	MaxAttempts    int           `help:"Max attempts per request, including retries" default:"5"`
+
+	EndpointsConfig
+	CacheConfig
+	ArchiveConfig
+}
+
+func (config CrawlConfig) userAgent() string {
+	if config.Contact == "" {
+		return config.UserAgent
+	}
+	return fmt.Sprintf("%s (+%s)", config.UserAgent, config.Contact)
+}
+
+// ErrRobotsDisallowed is returned for urls the host's robots.txt asks us not to crawl
+var ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// hostState is everything the Fetcher tracks per host
+type hostState struct {
+	limiter    *rateLimiter
+	robotsOnce sync.Once
+	robots     *robotsRules
+}
+
+// rateLimiter is a token bucket that can also be paused,
+// which is how we honor a Retry-After from the server
+type rateLimiter struct {
+	mu           sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise it
+// returns how long to wait before trying again
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Pause stops all requests to the host for d
+func (l *rateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, which is
+// either a number of seconds or an HTTP date
+func parseRetryAfter(header http.Header) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// robotsRules are the Allow and Disallow path prefixes
+// from the robots.txt group that applies to us
+type robotsRules struct {
+	allow    []string
+	disallow []string
+}
+
+// Allowed applies the longest matching rule, with Allow winning ties.
+// A nil robotsRules allows everything.
+func (rules *robotsRules) Allowed(path string) bool {
+	if rules == nil {
+		return true
+	}
+	longestAllow, longestDisallow := -1, -1
+	for _, prefix := range rules.allow {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longestAllow {
+			longestAllow = len(prefix)
+		}
+	}
+	for _, prefix := range rules.disallow {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longestDisallow {
+			longestDisallow = len(prefix)
+		}
+	}
+	return longestAllow >= longestDisallow
+}
+
+// parseRobots picks the group for agent out of a robots.txt,
+// falling back to the "*" group
+func parseRobots(body io.Reader, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	if i := strings.Index(agent, "/"); i >= 0 {
+		agent = agent[:i]
+	}
+
+	specific, generic := &robotsRules{}, &robotsRules{}
+	foundSpecific := false
+	var current []*robotsRules
+	inRules := false
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(split[0]))
+		value := strings.TrimSpace(split[1])
+
+		switch key {
+		case "user-agent":
+			// a user-agent line after rules starts a new group
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			name := strings.ToLower(value)
+			if name == "*" {
+				current = append(current, generic)
+			} else if name != "" && strings.Contains(agent, name) {
+				current = append(current, specific)
+				foundSpecific = true
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue // an empty Disallow allows everything
+			}
+			for _, rules := range current {
+				if key == "allow" {
+					rules.allow = append(rules.allow, value)
+				} else {
+					rules.disallow = append(rules.disallow, value)
+				}
+			}
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return generic
+}
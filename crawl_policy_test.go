@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"120", 120 * time.Second, 120 * time.Second},
+		{" 5 ", 5 * time.Second, 5 * time.Second},
+		{time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 85 * time.Second, 90 * time.Second},
+		{"", 0, 0},
+		{"0", 0, 0},
+		{"-3", 0, 0},
+		{"soon", 0, 0},
+	}
+
+	for _, test := range tests {
+		header := http.Header{}
+		header.Set("Retry-After", test.value)
+		if got := parseRetryAfter(header); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", test.value, got, test.min, test.max)
+		}
+	}
+
+	// a date in the past means no wait
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	if got := parseRetryAfter(header); got > 0 {
+		t.Errorf("parseRetryAfter(past date) = %s, want no wait", got)
+	}
+}
+
+const testRobots = `
+# everyone else
+User-agent: *
+Disallow: /sopa/
+Allow: /sopa/components/reports/
+
+User-agent: otherbot
+Disallow: /
+
+User-agent: googlebot
+User-agent: projectsdb
+Disallow: /private/
+Allow: /private/public/
+Disallow: /a
+Allow: /a
+Disallow:
+`
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		// our own group, not the * one
+		{"projectsdb/0.1 (+https://example.com)", "/sopa/forest-level.php?110515", true},
+		{"projectsdb/0.1", "/private/notes", false},
+		// the longest match wins
+		{"projectsdb/0.1", "/private/public/notes", true},
+		// Allow wins a tie
+		{"projectsdb/0.1", "/a/b", true},
+		{"projectsdb/0.1", "/", true},
+
+		// no group for the agent, so the * one
+		{"somebot/2.0", "/sopa/forest-level.php?110515", false},
+		{"somebot/2.0", "/sopa/components/reports/sopa-110515-2022-01.html", true},
+		{"somebot/2.0", "/private/notes", true},
+		{"otherbot/1.0", "/anything", false},
+	}
+
+	for _, test := range tests {
+		rules := parseRobots(strings.NewReader(testRobots), test.agent)
+		if allowed := rules.Allowed(test.path); allowed != test.allowed {
+			t.Errorf("%s allowed %s = %v, want %v", test.agent, test.path, allowed, test.allowed)
+		}
+	}
+
+	var none *robotsRules
+	if !none.Allowed("/anything") {
+		t.Errorf("no robots.txt disallowed a path")
+	}
+}
+
+func TestRateLimiterPacing(t *testing.T) {
+	ctx := context.Background()
+
+	// the burst goes out at once, then one every 1/rate
+	limiter := newRateLimiter(20, 2)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || elapsed > time.Second {
+		t.Errorf("6 requests at 20/s with a burst of 2 took %s, want about 200ms", elapsed)
+	}
+
+	// no rate is no limit
+	unlimited := newRateLimiter(0, 1)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		if err := unlimited.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("100 unlimited requests took %s", elapsed)
+	}
+
+	// a pause holds everything, even with tokens left
+	paused := newRateLimiter(0, 1)
+	paused.Pause(100 * time.Millisecond)
+	start = time.Now()
+	if err := paused.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("paused limiter let a request through after %s", elapsed)
+	}
+
+	// waiting stops with the context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	paused.Pause(time.Hour)
+	if err := paused.Wait(cancelled); err == nil {
+		t.Errorf("Wait returned no error for a cancelled context")
+	}
+}
+
+func TestNewFetcherRequestTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if _, err := NewFetcher(CrawlConfig{RequestTimeout: timeout, MaxAttempts: 1}); err == nil {
+			t.Errorf("NewFetcher accepted --request-timeout=%s", timeout)
+		}
+	}
+}
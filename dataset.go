@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// datasetSchemaVersion is the shape of the data sets we write. Files from
+// before there was an envelope are a bare array of forests, version 1.
+const datasetSchemaVersion = 2
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// Dataset is what parse-all-projects and parse-updates save, the forests
+// along with what produced them
+type Dataset struct {
+	DatasetHeader
+	Forests []Forest `json:"forests"`
+}
+
+// DatasetHeader is everything in a data set but the forests
+type DatasetHeader struct {
+	SchemaVersion int             `json:"schema_version"`
+	GeneratedAt   time.Time       `json:"generated_at"`
+	ToolVersion   string          `json:"tool_version"`
+	Endpoints     EndpointsConfig `json:"endpoints"`
+	Crawl         DatasetCrawl    `json:"crawl"`
+}
+
+// DatasetCrawl is the crawl policy and filters the data set was made with
+type DatasetCrawl struct {
+	UserAgent      string             `json:"user_agent"`
+	RateLimit      float64            `json:"rate_limit"`
+	Burst          int                `json:"burst"`
+	RequestTimeout string             `json:"request_timeout"`
+	MaxAttempts    int                `json:"max_attempts"`
+	RespectRobots  bool               `json:"respect_robots"`
+	Offline        bool               `json:"offline,omitempty"`
+	Replay         string             `json:"replay,omitempty"`
+	Since          string             `json:"since,omitempty"`
+	Filter         ForestFilterConfig `json:"filter"`
+}
+
+func newDataset(crawl CrawlConfig, filter ForestFilterConfig, forests []Forest) Dataset {
+	// purposes only filter what's posted or exported, never what's saved
+	filter.Purpose = nil
+	return Dataset{
+		DatasetHeader: DatasetHeader{
+			SchemaVersion: datasetSchemaVersion,
+			GeneratedAt:   time.Now().UTC(),
+			ToolVersion:   toolVersion(),
+			Endpoints:     crawl.EndpointsConfig,
+			Crawl: DatasetCrawl{
+				UserAgent:      crawl.userAgent(),
+				RateLimit:      crawl.RateLimit,
+				Burst:          crawl.Burst,
+				RequestTimeout: crawl.RequestTimeout.String(),
+				MaxAttempts:    crawl.MaxAttempts,
+				RespectRobots:  crawl.RespectRobots,
+				Offline:        crawl.Offline,
+				Replay:         crawl.Replay,
+				Filter:         filter,
+			},
+		},
+		Forests: forests,
+	}
+}
+
+// toolVersion falls back to the module version for go install'd binaries
+func toolVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// datasetMigrations bring a data set header from the version they're
+// keyed by up to the next one. Data sets are read a forest at a time, so
+// changes to forests belong in Forest.UnmarshalJSON instead.
+var datasetMigrations = map[int]func(header *DatasetHeader) error{
+	// projects saved as flat snapshots are converted
+	// as they're decoded, by Forest.UnmarshalJSON
+	1: func(header *DatasetHeader) error { return nil },
+}
+
+func migrateDataset(header *DatasetHeader) error {
+	if header.SchemaVersion > datasetSchemaVersion {
+		return fmt.Errorf("data set schema version %d is newer than this tool understands (%d)", header.SchemaVersion, datasetSchemaVersion)
+	}
+	for header.SchemaVersion < datasetSchemaVersion {
+		migrate, ok := datasetMigrations[header.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("no migration from data set schema version %d", header.SchemaVersion)
+		}
+		if err := migrate(header); err != nil {
+			return fmt.Errorf("migrating data set from schema version %d: %w", header.SchemaVersion, err)
+		}
+		header.SchemaVersion++
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Data sets are saved as JSON, an envelope holding an array of forests,
+// or as NDJSON, one record per line: the header, then each forest
+// followed by its projects, each followed by its updates and documents.
+// Either can be compressed, going by a .gz or .zst extension. Both are
+// written and read a forest at a time, though reading from a Store
+// still collects every forest.
+
+// ndjsonRecord is one line of an NDJSON data set. Projects, updates and
+// documents carry their forest's keys so lines can be used on their own.
+type ndjsonRecord struct {
+	Kind        string           `json:"kind"`
+	Header      *DatasetHeader   `json:"header,omitempty"`
+	Forest      *Forest          `json:"forest,omitempty"`
+	ForestId    int              `json:"forest_id,omitempty"`
+	ForestName  string           `json:"forest_name,omitempty"`
+	State       *State           `json:"state,omitempty"`
+	ProjectKey  string           `json:"project_key,omitempty"`
+	ProjectId   string           `json:"project_id,omitempty"`
+	SyntheticId string           `json:"synthetic_id,omitempty"`
+	Project     *Project         `json:"project,omitempty"`
+	Update      *ProjectUpdate   `json:"update,omitempty"`
+	Document    *ProjectDocument `json:"document,omitempty"`
+}
+
+const (
+	recordHeader   = "header"
+	recordForest   = "forest"
+	recordProject  = "project"
+	recordUpdate   = "update"
+	recordDocument = "document"
+)
+
+// writeDataset writes the data set in the format and compression the name's extension asks for
+func writeDataset(w io.Writer, name string, dataset Dataset) error {
+	cw, err := compress(w, compressionFor(name, ""))
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(cw)
+
+	if isNdjson(name) {
+		err = writeNdjsonDataset(buffered, dataset)
+	} else {
+		err = writeJsonDataset(buffered, dataset)
+	}
+	if err != nil {
+		cw.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// writeJsonDataset writes the envelope, then the forests one by one
+func writeJsonDataset(w io.Writer, dataset Dataset) error {
+	header, err := json.Marshal(dataset.DatasetHeader)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"forests":[`); err != nil {
+		return err
+	}
+	for i, forest := range dataset.Forests {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(forest)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+func writeNdjsonDataset(w io.Writer, dataset Dataset) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ndjsonRecord{Kind: recordHeader, Header: &dataset.DatasetHeader}); err != nil {
+		return err
+	}
+
+	for _, forest := range dataset.Forests {
+		projects := forest.Projects
+		forest.Projects = nil
+		if err := encoder.Encode(ndjsonRecord{Kind: recordForest, Forest: &forest}); err != nil {
+			return err
+		}
+
+		state := forest.State
+		for _, project := range projects {
+			record := ndjsonRecord{
+				ForestId:    forest.Id,
+				ForestName:  forest.Name,
+				State:       &state,
+				ProjectKey:  project.Key,
+				ProjectId:   project.Id,
+				SyntheticId: project.SyntheticId,
+			}
+
+			// written on its own so projects without updates or documents survive
+			record.Kind = recordProject
+			record.Project = &Project{
+				Key:         project.Key,
+				Id:          project.Id,
+				SyntheticId: project.SyntheticId,
+				Name:        project.Name,
+			}
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+			record.Project = nil
+
+			for i := range project.Updates {
+				record.Kind = recordUpdate
+				record.Update = &project.Updates[i]
+				if err := encoder.Encode(record); err != nil {
+					return err
+				}
+			}
+			record.Update = nil
+			for i := range project.Documents {
+				record.Kind = recordDocument
+				record.Document = &project.Documents[i]
+				if err := encoder.Encode(record); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readDataset reads a whole data set of any version or format
+func readDataset(r io.Reader, name string, contentEncoding string) (Dataset, error) {
+	dataset := Dataset{Forests: []Forest{}}
+	header, err := streamDataset(r, name, contentEncoding, func(forest Forest) error {
+		dataset.Forests = append(dataset.Forests, forest)
+		return nil
+	})
+	dataset.DatasetHeader = header
+	return dataset, err
+}
+
+// readDatasetFile reads a data set file, going by its extension
+func readDatasetFile(path string, fn func(forest Forest) error) (DatasetHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return DatasetHeader{}, err
+	}
+	defer file.Close()
+	return streamDataset(file, path, "", fn)
+}
+
+// streamDataset calls fn with each forest as it's read, without holding the
+// whole data set in memory, and returns the migrated header. The format
+// and compression go by name, then the content encoding, then what the
+// data looks like.
+func streamDataset(r io.Reader, name string, contentEncoding string, fn func(forest Forest) error) (DatasetHeader, error) {
+	rc, err := decompress(r, compressionFor(name, contentEncoding))
+	if err != nil {
+		return DatasetHeader{}, err
+	}
+	defer rc.Close()
+	buffered := bufio.NewReader(rc)
+
+	var header DatasetHeader
+	if isNdjson(name) {
+		header, err = streamNdjsonDataset(buffered, fn)
+	} else {
+		header, err = streamJsonDataset(buffered, fn)
+	}
+	if err != nil {
+		return header, err
+	}
+	return header, migrateDataset(&header)
+}
+
+// streamJsonDataset reads an envelope, or a bare array of forests from
+// before there was one, decoding the forests one at a time
+func streamJsonDataset(r io.Reader, fn func(forest Forest) error) (DatasetHeader, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return DatasetHeader{}, err
+	}
+
+	if token == json.Delim('[') {
+		return DatasetHeader{SchemaVersion: 1}, streamForestArray(decoder, fn, false)
+	} else if token != json.Delim('{') {
+		return DatasetHeader{}, fmt.Errorf("data set is not a JSON object or array, starts with %v", token)
+	}
+
+	// collect everything but the forests, which are handed off as they're decoded
+	fields := map[string]json.RawMessage{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return DatasetHeader{}, err
+		}
+		key, _ := token.(string)
+		if key == "forests" {
+			if err := streamForestArray(decoder, fn, true); err != nil {
+				return DatasetHeader{}, err
+			}
+			continue
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return DatasetHeader{}, err
+		}
+		fields[key] = value
+	}
+
+	header := DatasetHeader{}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return header, err
+	}
+	return header, json.Unmarshal(data, &header)
+}
+
+// streamForestArray decodes the array's forests, after its opening [ when started
+func streamForestArray(decoder *json.Decoder, fn func(forest Forest) error, start bool) error {
+	if start {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token == nil {
+			return nil
+		} else if token != json.Delim('[') {
+			return fmt.Errorf("forests is not an array, starts with %v", token)
+		}
+	}
+
+	for decoder.More() {
+		forest := Forest{}
+		if err := decoder.Decode(&forest); err != nil {
+			return err
+		}
+		if err := fn(forest); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+func streamNdjsonDataset(r *bufio.Reader, fn func(forest Forest) error) (DatasetHeader, error) {
+	header := DatasetHeader{}
+	var forest *Forest
+	projects := map[string]int{}
+
+	flush := func() error {
+		if forest == nil {
+			return nil
+		}
+		err := fn(*forest)
+		forest = nil
+		return err
+	}
+
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		record := ndjsonRecord{}
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return header, fmt.Errorf("record %d: %w", line, err)
+		}
+
+		switch record.Kind {
+		case recordHeader:
+			if record.Header != nil {
+				header = *record.Header
+			}
+
+		case recordForest:
+			if err := flush(); err != nil {
+				return header, err
+			}
+			if record.Forest == nil {
+				return header, fmt.Errorf("record %d: forest record without a forest", line)
+			}
+			forest = record.Forest
+			projects = map[string]int{}
+
+		case recordProject, recordUpdate, recordDocument:
+			if forest == nil || forest.Id != record.ForestId {
+				return header, fmt.Errorf("record %d: %s for forest %d outside of it", line, record.Kind, record.ForestId)
+			}
+			if record.Kind == recordProject && record.Project == nil {
+				return header, fmt.Errorf("record %d: project record without a project", line)
+			}
+			// data sets written before project records had
+			// them made from their updates and documents
+			i, ok := projects[record.ProjectKey]
+			if !ok {
+				forest.Projects = append(forest.Projects, Project{
+					Key:         record.ProjectKey,
+					Id:          record.ProjectId,
+					SyntheticId: record.SyntheticId,
+				})
+				i = len(forest.Projects) - 1
+				projects[record.ProjectKey] = i
+			}
+			if record.Project != nil {
+				forest.Projects[i].Name = record.Project.Name
+			}
+			if record.Update != nil {
+				forest.Projects[i].AddUpdate(*record.Update)
+			}
+			if record.Document != nil {
+				forest.Projects[i].AddDocuments([]ProjectDocument{*record.Document})
+			}
+
+		default:
+			return header, fmt.Errorf("record %d: unknown kind %q", line, record.Kind)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+// encodeDataset is writeDataset into memory
+func encodeDataset(name string, dataset Dataset) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeDataset(&buf, name, dataset)
+	return buf.Bytes(), err
+}
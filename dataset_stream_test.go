@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestStoreFormatsRoundTrip(t *testing.T) {
+	forests := testForests()
+	forests[0].Projects = append(forests[0].Projects, Project{Key: "50009", Id: "50009", Name: "No Updates Yet"})
+	forests[0].Project("50001").AddDocuments([]ProjectDocument{{Url: "https://example.com/a.pdf", Name: "Scoping Letter"}})
+	want := newDataset(CrawlConfig{}, ForestFilterConfig{}, forests)
+
+	ctx := context.Background()
+	for _, format := range []string{"json", "json.gz", "json.zst", "ndjson", "ndjson.gz", "ndjson.zst"} {
+		store := newMemoryStore(format)
+		if err := store.Save(ctx, "2022-01-01", want); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := store.Load(ctx, "2022-01-01")
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if got.SchemaVersion != want.SchemaVersion || !got.GeneratedAt.Equal(want.GeneratedAt) {
+			t.Errorf("%s: header = %+v, want %+v", format, got.DatasetHeader, want.DatasetHeader)
+		}
+		assertSameForests(t, format, got.Forests, want.Forests)
+	}
+}
+
+func TestReadLegacyArrayDataset(t *testing.T) {
+	data := []byte(`[` + legacyForestJson + `]`)
+	dataset, err := readDataset(bytes.NewReader(data), "forests.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataset.SchemaVersion != datasetSchemaVersion {
+		t.Errorf("schema version = %d, want it migrated to %d", dataset.SchemaVersion, datasetSchemaVersion)
+	}
+	if len(dataset.Forests) != 1 || len(dataset.Forests[0].Projects) != 2 {
+		t.Errorf("forests = %+v, want the one legacy forest with its two projects", dataset.Forests)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// dirStore keeps snapshots as files in a local directory
+type dirStore struct {
+	dir    string
+	format string
+}
+
+func newDirStore(dir string, format string) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir, format: format}, nil
+}
+
+func (store *dirStore) List(ctx context.Context) ([]string, error) {
+	return store.list(snapshotDate)
+}
+
+// list returns what name returns for each file it doesn't return "" for, sorted
+func (store *dirStore) list(name func(file string) string) ([]string, error) {
+	entries, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if n := name(entry.Name()); n != "" && !entry.IsDir() {
+			names = append(names, n)
+		}
+	}
+	return uniqueSorted(names), nil
+}
+
+func (store *dirStore) LoadLatest(ctx context.Context) (Dataset, string, error) {
+	return loadLatest(ctx, store)
+}
+
+func (store *dirStore) Load(ctx context.Context, date string) (Dataset, error) {
+	for _, name := range snapshotNames(date, store.format) {
+		file, err := os.Open(filepath.Join(store.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return Dataset{}, err
+		}
+		defer file.Close()
+		return readDataset(file, name, "")
+	}
+	return Dataset{}, fmt.Errorf("no data set snapshot for %s in %s", date, store.dir)
+}
+
+func (store *dirStore) Save(ctx context.Context, date string, dataset Dataset) error {
+	name := snapshotName(date, store.format)
+	return writeFileAtomicWith(filepath.Join(store.dir, name), func(w io.Writer) error {
+		return writeDataset(w, name, dataset)
+	})
+}
+
+func (store *dirStore) ListChangeSets(ctx context.Context) ([]string, error) {
+	return store.list(changeSetId)
+}
+
+func (store *dirStore) LoadChangeSet(ctx context.Context, id string) (ChangeSet, error) {
+	data, err := ioutil.ReadFile(filepath.Join(store.dir, changeSetName(id)))
+	if err != nil {
+		return ChangeSet{}, err
+	}
+	return decodeChangeSet(data)
+}
+
+func (store *dirStore) SaveChangeSet(ctx context.Context, changeSet ChangeSet) error {
+	data, err := json.Marshal(changeSet)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(store.dir, changeSetName(changeSet.Id)), data)
+}
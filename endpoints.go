@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// EndpointsConfig is where the USFS data is scraped from. Everything
+// can be overridden so we can follow the site when content moves
+// between fs.fed.us and fs.usda.gov, or point at a local mirror.
+type EndpointsConfig struct {
+	BaseUrl         string `json:"base_url" help:"Base url that links on the SOPA pages are resolved against" default:"https://www.fs.fed.us" env:"PROJECTSDB_BASE_URL"`
+	NavPagePath     string `json:"nav_page_path" help:"Path of the page listing every forest" default:"/sopa/nav-page.php" env:"PROJECTSDB_NAV_PAGE_PATH"`
+	ForestLevelPath string `json:"forest_level_path" help:"Path of the page listing a forest's SOPA reports, the forest id is added as the query. Overrides the links scraped from the nav page" env:"PROJECTSDB_FOREST_LEVEL_PATH"`
+	ReportsPath     string `json:"reports_path" help:"Path of the directory holding the SOPA report pages. Overrides the links scraped from forest-level pages" env:"PROJECTSDB_REPORTS_PATH"`
+	NepaRssUrl      string `json:"nepa_rss_url" help:"NEPA project documents RSS feed, the project id is added as ?project=" default:"https://www.fs.usda.gov/wps/PA_Nepa/neparssgetfile" env:"PROJECTSDB_NEPA_RSS_URL"`
+}
+
+func (endpoints EndpointsConfig) NavPageUrl() string {
+	return endpoints.join(endpoints.NavPagePath)
+}
+
+// defaultForestLevelPath is used to build a forest's url when
+// there's no scraped link to go by and no override
+const defaultForestLevelPath = "/sopa/forest-level.php"
+
+// ForestLevelUrl looks like https://www.fs.fed.us/sopa/forest-level.php?110801
+func (endpoints EndpointsConfig) ForestLevelUrl(id int) string {
+	forestLevelPath := endpoints.ForestLevelPath
+	if forestLevelPath == "" {
+		forestLevelPath = defaultForestLevelPath
+	}
+	return fmt.Sprintf("%s?%d", endpoints.join(forestLevelPath), id)
+}
+
+// ForestLinkUrl takes a forest link from the nav page. It's followed
+// as is unless ForestLevelPath is set, then the forest id is moved there.
+func (endpoints EndpointsConfig) ForestLinkUrl(href string, id int) string {
+	if endpoints.ForestLevelPath != "" && id != 0 {
+		return endpoints.ForestLevelUrl(id)
+	}
+	return endpoints.ResolveLink(href)
+}
+
+// ReportUrl takes a report link from a forest-level page. It's followed
+// as is unless ReportsPath is set, then it's moved there keeping just
+// the file name
+// https://www.fs.fed.us/sopa/components/reports/sopa-110519-2021-07.html
+func (endpoints EndpointsConfig) ReportUrl(href string) string {
+	if endpoints.ReportsPath == "" {
+		return endpoints.ResolveLink(href)
+	}
+	return endpoints.join(strings.TrimSuffix(endpoints.ReportsPath, "/") + "/" + path.Base(href))
+}
+
+func (endpoints EndpointsConfig) ProjectDocumentsUrl(projectId string) string {
+	return fmt.Sprintf("%s?project=%s", endpoints.NepaRssUrl, url.QueryEscape(projectId))
+}
+
+// ResolveLink turns a link found on a page into an absolute url
+func (endpoints EndpointsConfig) ResolveLink(href string) string {
+	base, err := url.Parse(endpoints.BaseUrl)
+	if err != nil {
+		return endpoints.join(href)
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return endpoints.join(href)
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// ForestUrl is where to find the forest's SOPA reports today. It's the
+// saved url unless ForestLevelPath is set because the pages have moved.
+func (endpoints EndpointsConfig) ForestUrl(forest Forest) string {
+	if forest.Id == 0 || (forest.Url != "" && endpoints.ForestLevelPath == "") {
+		return forest.Url
+	}
+	return endpoints.ForestLevelUrl(forest.Id)
+}
+
+func (endpoints EndpointsConfig) join(p string) string {
+	return strings.TrimSuffix(endpoints.BaseUrl, "/") + "/" + strings.TrimPrefix(p, "/")
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestEndpointsFollowScrapedLinks(t *testing.T) {
+	scraped := EndpointsConfig{BaseUrl: "https://www.fs.usda.gov/"}
+	moved := EndpointsConfig{
+		BaseUrl:         "http://localhost:8080",
+		ForestLevelPath: "/mirror/forest-level.php",
+		ReportsPath:     "/mirror/reports",
+	}
+	const reportHref = "/sopa/components/reports/sopa-110519-2021-07.html"
+	const forestHref = "/sopa/forest-level.php?110519"
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"report", scraped.ReportUrl(reportHref), "https://www.fs.usda.gov/sopa/components/reports/sopa-110519-2021-07.html"},
+		{"absolute report", scraped.ReportUrl("https://www.fs.fed.us/sopa/r.html"), "https://www.fs.fed.us/sopa/r.html"},
+		{"moved report", moved.ReportUrl(reportHref), "http://localhost:8080/mirror/reports/sopa-110519-2021-07.html"},
+		{"forest", scraped.ForestLinkUrl(forestHref, 110519), "https://www.fs.usda.gov/sopa/forest-level.php?110519"},
+		{"moved forest", moved.ForestLinkUrl(forestHref, 110519), "http://localhost:8080/mirror/forest-level.php?110519"},
+		{"moved forest without id", moved.ForestLinkUrl("/sopa/other.php", 0), "http://localhost:8080/sopa/other.php"},
+		{"saved forest", scraped.ForestUrl(Forest{Id: 110519, Url: "https://www.fs.fed.us/sopa/forest-level.php?110519"}), "https://www.fs.fed.us/sopa/forest-level.php?110519"},
+		{"saved forest moved", moved.ForestUrl(Forest{Id: 110519, Url: "https://www.fs.fed.us/sopa/forest-level.php?110519"}), "http://localhost:8080/mirror/forest-level.php?110519"},
+		{"saved forest without url", scraped.ForestUrl(Forest{Id: 110519}), "https://www.fs.usda.gov/sopa/forest-level.php?110519"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s url = %q, want %q", test.name, test.got, test.want)
+		}
+	}
+}
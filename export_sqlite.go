@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ExportSqliteConfig struct {
+	ForestDataFile string `help:"Forest data file to export instead of a snapshot from the store, JSON or NDJSON, optionally .gz or .zst compressed" type:"path"`
+	Date           string `help:"Date of the store snapshot to export as it was saved. When empty the latest, with every change set since applied" placeholder:"YYYY-MM-DD"`
+	Sqlite         string `required help:"SQLite database to write, forests already in it are replaced" type:"path" placeholder:"FILE"`
+
+	ForestFilterConfig
+	StoreConfig
+}
+
+// ExportSqlite writes a data set of any version to a SQLite database,
+// a forest at a time as it's read when exporting a file
+func ExportSqlite(ctx context.Context, config ExportSqliteConfig) error {
+	db, err := openSqlite(ctx, config.Sqlite)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	export := config.Selected(func(forest Forest) error {
+		if err := db.SaveForest(ctx, forest); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"forest": forest.Name,
+			"state":  forest.State,
+			"count":  len(forest.Projects),
+		}).Info("Exported forest")
+		return nil
+	})
+
+	if config.ForestDataFile != "" {
+		_, err := readDatasetFile(config.ForestDataFile, export)
+		return err
+	}
+
+	store, err := config.OpenStore(storeDir)
+	if err != nil {
+		return err
+	}
+	var dataset Dataset
+	if config.Date != "" {
+		dataset, err = store.Load(ctx, config.Date)
+	} else {
+		dataset, _, err = loadCurrent(ctx, store)
+	}
+	if err != nil {
+		return err
+	}
+	for _, forest := range dataset.Forests {
+		if err := export(forest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Fetcher makes GET requests against the USFS websites.
+// Every attempt gets its own timeout, and failed attempts are
+// retried with exponential backoff only when the failure looks
+// transient (network errors, 5xx, 429). The number of attempts
+// is capped so a single bad page can't stall a whole crawl.
+// Requests to each host are rate limited per the CrawlConfig,
+// and responses are optionally cached on disk and revalidated
+// with conditional GETs. Responses can also be recorded to an
+// archive and replayed later without touching the network.
+type Fetcher struct {
+	Client      *http.Client
+	Timeout     time.Duration
+	MaxAttempts int
+	Crawl       CrawlConfig
+
+	cache  *responseStore
+	record *responseStore
+	replay *responseStore
+	mu     sync.Mutex
+	hosts  map[string]*hostState
+}
+
+func NewFetcher(config CrawlConfig) (*Fetcher, error) {
+	fetcher := &Fetcher{
+		Client:      &http.Client{},
+		Timeout:     config.RequestTimeout,
+		MaxAttempts: config.MaxAttempts,
+		Crawl:       config,
+		hosts:       map[string]*hostState{},
+	}
+
+	// a zero timeout would fail every request before it's sent
+	if config.RequestTimeout <= 0 {
+		return nil, fmt.Errorf("--request-timeout must be positive, got %s", config.RequestTimeout)
+	}
+	if config.Offline && config.CacheDir == "" {
+		return nil, errors.New("--offline needs a --cache-dir to serve from")
+	}
+	if config.CacheDir != "" {
+		cache, err := newResponseStore(config.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		fetcher.cache = cache
+	}
+
+	if config.Record != "" && config.Replay != "" {
+		return nil, errors.New("--record and --replay can't be used together")
+	}
+	if config.Record != "" {
+		record, err := newResponseStore(config.Record)
+		if err != nil {
+			return nil, err
+		}
+		fetcher.record = record
+	}
+	if config.Replay != "" {
+		if _, err := os.Stat(config.Replay); err != nil {
+			return nil, err
+		}
+		fetcher.replay = &responseStore{dir: config.Replay}
+	}
+
+	return fetcher, nil
+}
+
+// StatusError is returned when the server answers with a non 2xx status
+type StatusError struct {
+	Url        string
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.Url, e.Status)
+}
+
+// FetchError is returned once a request has failed for good, either
+// because the error was not retryable or the retry budget ran out
+type FetchError struct {
+	Url      string
+	Attempts int
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("GET %s failed after %d attempt(s): %s", e.Url, e.Attempts, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Get fetches rawUrl and returns the response. The caller must close
+// the response body, which also releases the request's timeout.
+func (f *Fetcher) Get(ctx context.Context, rawUrl string) (*http.Response, error) {
+	if f.replay != nil {
+		return f.replayResponse(rawUrl)
+	}
+
+	res, err := f.get(ctx, rawUrl)
+	if f.record != nil {
+		return f.recordResponse(rawUrl, res, err)
+	}
+	return res, err
+}
+
+// Download fetches a document, like a project PDF, straight from the
+// network. Documents are large and only fetched once, so they skip the
+// response cache and the archive rather than being held in memory.
+func (f *Fetcher) Download(ctx context.Context, rawUrl string) (*http.Response, error) {
+	if f.Crawl.Offline || f.replay != nil {
+		return nil, &FetchError{Url: rawUrl, Err: ErrNotCached}
+	}
+	return f.fetch(ctx, rawUrl, nil)
+}
+
+// get serves rawUrl from the cache when possible, otherwise from the network
+func (f *Fetcher) get(ctx context.Context, rawUrl string) (*http.Response, error) {
+	if f.cache == nil {
+		return f.fetch(ctx, rawUrl, nil)
+	}
+
+	entry, err := f.cache.Load(rawUrl)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":   rawUrl,
+			"error": err.Error(),
+		}).Warn("Unable to read cached response, fetching again")
+		entry = nil
+	}
+
+	if f.Crawl.Offline {
+		if entry == nil {
+			return nil, &FetchError{Url: rawUrl, Err: ErrNotCached}
+		}
+		return entry.Response(), nil
+	}
+	if entry != nil && time.Since(entry.FetchedAt) < f.Crawl.CacheTtl {
+		return entry.Response(), nil
+	}
+
+	res, err := f.fetch(ctx, rawUrl, entry.conditionalHeader())
+	var statusErr *StatusError
+	if entry != nil && errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotModified {
+		entry.FetchedAt = time.Now().UTC()
+		f.saveToCache(entry)
+		return entry.Response(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry, err = readResponse(rawUrl, res)
+	if err != nil {
+		return nil, &FetchError{Url: rawUrl, Attempts: 1, Err: err}
+	}
+	f.saveToCache(entry)
+	return entry.Response(), nil
+}
+
+// saveToCache only logs on failure, a broken cache shouldn't stop a crawl
+func (f *Fetcher) saveToCache(entry *cachedResponse) {
+	if err := f.cache.Save(entry); err != nil {
+		log.WithFields(log.Fields{
+			"url":   entry.Url,
+			"error": err.Error(),
+		}).Warn("Unable to write response to cache")
+	}
+}
+
+// fetch sends the request with retries, adding header to every attempt
+func (f *Fetcher) fetch(ctx context.Context, rawUrl string, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, &FetchError{Url: rawUrl, Err: err}
+	}
+	host := f.host(u.Host)
+
+	if f.Crawl.RespectRobots && !f.allowedByRobots(ctx, host, u) {
+		return nil, &FetchError{Url: rawUrl, Err: ErrRobotsDisallowed}
+	}
+
+	backo := backoff.NewExponentialBackOff()
+	backo.MaxElapsedTime = 0 // attempts are capped by MaxAttempts instead
+
+	for attempt := 1; ; attempt++ {
+		if err := host.limiter.Wait(ctx); err != nil {
+			return nil, &FetchError{Url: rawUrl, Attempts: attempt - 1, Err: err}
+		}
+
+		res, err := f.do(ctx, rawUrl, header)
+		if err == nil {
+			return res, nil
+		}
+		if !isRetryable(err) || attempt >= f.MaxAttempts {
+			return nil, &FetchError{Url: rawUrl, Attempts: attempt, Err: err}
+		}
+
+		sleepTime := backo.NextBackOff()
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			// hold off every request to this host, not just this one
+			host.limiter.Pause(statusErr.RetryAfter)
+			if statusErr.RetryAfter > sleepTime {
+				sleepTime = statusErr.RetryAfter
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"url":     rawUrl,
+			"attempt": attempt,
+			"error":   err.Error(),
+			"sleep":   sleepTime.String(),
+		}).Warn("Request failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return nil, &FetchError{Url: rawUrl, Attempts: attempt, Err: ctx.Err()}
+		case <-time.After(sleepTime):
+		}
+	}
+}
+
+func (f *Fetcher) do(ctx context.Context, rawUrl string, header http.Header) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", f.Crawl.userAgent())
+
+	res, err := f.Client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		statusErr := &StatusError{
+			Url:        rawUrl,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+		}
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = parseRetryAfter(res.Header)
+		}
+
+		// drain a little of the body so the connection can be reused
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+		cancel()
+		return nil, statusErr
+	}
+
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+func (f *Fetcher) host(name string) *hostState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	host, ok := f.hosts[name]
+	if !ok {
+		host = &hostState{
+			limiter: newRateLimiter(f.Crawl.RateLimit, f.Crawl.Burst),
+		}
+		f.hosts[name] = host
+	}
+	return host
+}
+
+// allowedByRobots fetches the host's robots.txt the first time it
+// is needed. A missing or unreadable robots.txt allows everything.
+func (f *Fetcher) allowedByRobots(ctx context.Context, host *hostState, u *url.URL) bool {
+	host.robotsOnce.Do(func() {
+		robotsUrl := fmt.Sprintf("%s://%s/robots.txt", u.Scheme, u.Host)
+		if err := host.limiter.Wait(ctx); err != nil {
+			return
+		}
+		res, err := f.do(ctx, robotsUrl, nil)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"url":   robotsUrl,
+				"error": err.Error(),
+			}).Warn("Unable to get robots.txt, assuming everything is allowed")
+			return
+		}
+		defer res.Body.Close()
+		host.robots = parseRobots(res.Body, f.Crawl.UserAgent)
+	})
+	return host.robots.Allowed(u.RequestURI())
+}
+
+// isRetryable reports whether a failed attempt is worth trying again.
+// Network errors, 5xx and 429 are, anything else the server told us
+// (404, 403, ...) will not change by asking again.
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// cancelOnClose releases a request's timeout context once
+// the caller is done reading the body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFetcher(t *testing.T, config CrawlConfig) *Fetcher {
+	t.Helper()
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = time.Second
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 3
+	}
+	fetcher, err := NewFetcher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fetcher
+}
+
+// countingServer answers every request with handler, counting them
+func countingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func statusHandler(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}
+}
+
+// dropConnection fails the request with a network error
+func dropConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func TestFetcherRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		attempts int32
+		status   int
+	}{
+		{"not found", statusHandler(http.StatusNotFound), 1, http.StatusNotFound},
+		{"forbidden", statusHandler(http.StatusForbidden), 1, http.StatusForbidden},
+		{"server error", statusHandler(http.StatusInternalServerError), 3, http.StatusInternalServerError},
+		{"bad gateway", statusHandler(http.StatusBadGateway), 3, http.StatusBadGateway},
+		{"too many requests", statusHandler(http.StatusTooManyRequests), 3, http.StatusTooManyRequests},
+		{"network error", dropConnection, 3, 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// the retries back off for real, so run them side by side
+			t.Parallel()
+			server, requests := countingServer(t, test.handler)
+			fetcher := newTestFetcher(t, CrawlConfig{MaxAttempts: 3})
+
+			_, err := fetcher.Get(context.Background(), server.URL)
+			var fetchErr *FetchError
+			if !errors.As(err, &fetchErr) {
+				t.Fatalf("err = %v, want a FetchError", err)
+			}
+			if got := atomic.LoadInt32(requests); got != test.attempts || int32(fetchErr.Attempts) != test.attempts {
+				t.Errorf("server saw %d requests, error says %d attempts, want %d", got, fetchErr.Attempts, test.attempts)
+			}
+
+			var statusErr *StatusError
+			if test.status == 0 {
+				if errors.As(err, &statusErr) {
+					t.Errorf("err = %v, want a network error", err)
+				}
+			} else if !errors.As(err, &statusErr) || statusErr.StatusCode != test.status {
+				t.Errorf("err = %v, want status %d", err, test.status)
+			}
+		})
+	}
+}
+
+func TestFetcherRetrySucceeds(t *testing.T) {
+	var failures int32 = 1
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	fetcher := newTestFetcher(t, CrawlConfig{MaxAttempts: 3})
+
+	res, err := fetcher.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+}
+
+func TestFetcherAttemptTimeout(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	fetcher := newTestFetcher(t, CrawlConfig{MaxAttempts: 2, RequestTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := fetcher.Get(context.Background(), server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the attempt to time out", err)
+	}
+	// each attempt gets its own timeout, and a timeout is retried
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("took %s, the attempts didn't time out", elapsed)
+	}
+}
@@ -1,84 +1,118 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"encoding/csv"
+	"os"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type ForestJsonToCsvConfig struct {
-	ForestDataFile string `required help:"Forest Data JSON File" type:"path"`
+	ForestDataFile string `required help:"Forest data file, JSON or NDJSON, optionally .gz or .zst compressed" type:"path"`
+
+	ForestFilterConfig
 }
 
-func ForestJsonToCsv(config ForestJsonToCsvConfig) error {
-	// Read file off disk into memory
-	file, err := ioutil.ReadFile(config.ForestDataFile)
+// csvFile is one of the CSV files written, a forest's rows at a time
+type csvFile struct {
+	path   string
+	file   *os.File
+	writer *csv.Writer
+	write  func(w *csv.Writer, forest Forest) error
+}
+
+func createCsvFile(path string, write func(w *csv.Writer, forest Forest) error) (*csvFile, error) {
+	file, err := os.Create(path)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"file":  config.ForestDataFile,
-			"error": err.Error(),
-		}).Error("Unable to open forest data file")
-		return err
+		return nil, err
 	}
+	return &csvFile{path: path, file: file, writer: csv.NewWriter(file), write: write}, nil
+}
 
-	forests := []Forest{}
-
-	// Parse data blob into struct
-	err = json.Unmarshal([]byte(file), &forests)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"file":  config.ForestDataFile,
-			"error": err.Error(),
-		}).Error("Unable to parse forest data file")
+func (f *csvFile) Close() error {
+	f.writer.Flush()
+	if err := f.writer.Error(); err != nil {
+		f.file.Close()
 		return err
 	}
+	return f.file.Close()
+}
 
-	filePath := "data/forest.csv"
-	err = writeForestCsv(forests, filePath)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"file":  filePath,
-			"error": err.Error(),
-		}).Error("Unable to write CSV")
-		return err
+func ForestJsonToCsv(config ForestJsonToCsvConfig) error {
+	files := []*csvFile{}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, output := range []struct {
+		path  string
+		write func(w *csv.Writer, forest Forest) error
+	}{
+		{"data/forest.csv", writeForestCsv},
+		{"data/projects.csv", writeProjectsCsv},
+		{"data/project_updates.csv", writeProjectUpdatesCsv},
+	} {
+		file, err := createCsvFile(output.path, output.write)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file":  output.path,
+				"error": err.Error(),
+			}).Error("Unable to create CSV")
+			return err
+		}
+		files = append(files, file)
 	}
 
-	filePath = "data/projects.csv"
-	err = writeProjectsCsv(forests, filePath)
+	// Stream the file in, migrating older data sets, and
+	// write each forest's rows before reading the next
+	_, err := readDatasetFile(config.ForestDataFile, config.Selected(func(forest Forest) error {
+		for _, file := range files {
+			if err := file.write(file.writer, forest); err != nil {
+				log.WithFields(log.Fields{
+					"file":   file.path,
+					"forest": forest.Name,
+					"error":  err.Error(),
+				}).Error("Unable to write CSV")
+				return err
+			}
+		}
+		return nil
+	}))
 	if err != nil {
 		log.WithFields(log.Fields{
-			"file":  filePath,
+			"file":  config.ForestDataFile,
 			"error": err.Error(),
-		}).Error("Unable to write CSV")
+		}).Error("Unable to read forest data file")
 		return err
 	}
 
-	filePath = "data/project_updates.csv"
-	err = writeProjectUpdatesCsv(forests, filePath)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"file":  filePath,
-			"error": err.Error(),
-		}).Error("Unable to write CSV")
-		return err
+	for _, file := range files {
+		if err := file.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"file":  file.path,
+				"error": err.Error(),
+			}).Error("Unable to write CSV")
+			return err
+		}
 	}
+	files = nil
 
 	return nil
 }
 
 // TODO(hank)
-func writeForestCsv(forests []Forest, path string) error {
+func writeForestCsv(w *csv.Writer, forest Forest) error {
 	return nil
 }
 
 // TODO(hank)
-func writeProjectsCsv(forests []Forest, path string) error {
+func writeProjectsCsv(w *csv.Writer, forest Forest) error {
 	return nil
 }
 
 // TODO(hank)
-func writeProjectUpdatesCsv(forests []Forest, path string) error {
+func writeProjectUpdatesCsv(w *csv.Writer, forest Forest) error {
 
 	return nil
 }
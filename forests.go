@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"path"
 	"strconv"
 	"strings"
 
@@ -12,36 +12,57 @@ import (
 // GetForests goes to the naviation page of the USFS website
 // and pulls the name, state, id, and url for each forest.
 // This function only makes 1 web request
-func GetForests() ([]Forest, error) {
+func GetForests(ctx context.Context, fetcher *Fetcher) ([]Forest, error) {
 	// get nav page html
-	url := fmt.Sprintf("%s/sopa/nav-page.php", baseUrl)
-	res := get(url)
+	url := fetcher.Crawl.NavPageUrl()
+	res, err := fetcher.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
 
 	// load the HTML document into goquery document
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// iterate through ul's while holding the context
 	// of what state container we're in
 	forests := []Forest{}
-	state := ""
+	state := State{}
+	var stateIssue *ParseIssue
 	doc.Find("table #content-table div").Last().Children().Each(func(i int, s *goquery.Selection) {
 		if s.Is("h3") {
-			state = s.Text()
+			stateIssue = nil
+			state, err = ParseState(s.Text())
+			if err != nil {
+				state = State{Name: trim(s.Text())}
+				stateIssue = &ParseIssue{
+					PageUrl: url,
+					Row:     i,
+					Field:   "state",
+					Raw:     s.Text(),
+					Reason:  err.Error(),
+				}
+			}
 		} else if s.Is("ul") {
 			s.Find("a").Each(func(i int, s *goquery.Selection) {
 				val, exists := s.Attr("href")
 				if !exists {
 					val = ""
 				}
-				forests = append(forests, Forest{
+				forest := Forest{
 					State: state,
 					Name:  s.Text(),
-					Url:   fmt.Sprintf("%s%s", baseUrl, val),
 					Id:    getIdFromUri(val),
-				})
+				}
+				forest.Url = fetcher.Crawl.ForestLinkUrl(val, forest.Id)
+				forest.Region = regionFromForestId(forest.Id)
+				if stateIssue != nil {
+					forest.ParseIssues = append(forest.ParseIssues, *stateIssue)
+				}
+				forests = append(forests, forest)
 			})
 		}
 	})
@@ -61,3 +82,121 @@ func getIdFromUri(uri string) int {
 	}
 	return id
 }
+
+// ForestFilterConfig picks which forests a command works on.
+// Filters combine with AND, an empty filter matches everything.
+type ForestFilterConfig struct {
+	State      []State      `json:"state,omitempty" help:"Only forests in these states, by USPS code or name" placeholder:"STATE"`
+	Region     []USFSRegion `json:"region,omitempty" help:"Only forests in these USFS regions, e.g. R5" placeholder:"REGION"`
+	ForestId   []int        `json:"forest_id,omitempty" help:"Only forests with these ids, the number after ? in the forest-level url" placeholder:"ID"`
+	ForestName string       `json:"forest_name,omitempty" help:"Only forests whose name matches this glob, e.g. \"*Mountain*\"" placeholder:"GLOB"`
+	Limit      int          `json:"limit,omitempty" help:"Stop after this many matching forests, 0 for no limit"`
+
+	Purpose []PurposeCode `json:"purpose,omitempty" help:"Only post or export projects with any of these USFS purpose codes, e.g. HF for fuels management. Saved data sets keep every project" placeholder:"CODE"`
+}
+
+func (filter ForestFilterConfig) Matches(forest Forest) bool {
+	if len(filter.State) > 0 {
+		found := false
+		for _, state := range filter.State {
+			if state.Code == forest.State.Code {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.Region) > 0 {
+		region := forest.Region
+		if region == RegionUnknown {
+			region = regionFromForestId(forest.Id)
+		}
+		found := false
+		for _, r := range filter.Region {
+			if r == region {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.ForestId) > 0 {
+		found := false
+		for _, id := range filter.ForestId {
+			if id == forest.Id {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.ForestName != "" {
+		matched, err := path.Match(strings.ToLower(filter.ForestName), strings.ToLower(forest.Name))
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SelectsForests is whether any forest filter is set, so
+// a crawl with them doesn't cover every forest
+func (filter ForestFilterConfig) SelectsForests() bool {
+	return len(filter.State) > 0 || len(filter.Region) > 0 || len(filter.ForestId) > 0 || filter.ForestName != "" || filter.Limit > 0
+}
+
+// MatchesProject is whether the snapshot has one of the filtered purposes
+func (filter ForestFilterConfig) MatchesProject(update ProjectUpdate) bool {
+	return len(filter.Purpose) == 0 || update.HasPurpose(filter.Purpose)
+}
+
+// FilterProjects drops the forest's projects whose
+// newest snapshot doesn't match the project filters
+func (filter ForestFilterConfig) FilterProjects(forest Forest) Forest {
+	if len(filter.Purpose) == 0 {
+		return forest
+	}
+	projects := []Project{}
+	for _, project := range forest.Projects {
+		if filter.MatchesProject(project.Current()) {
+			projects = append(projects, project)
+		}
+	}
+	forest.Projects = projects
+	return forest
+}
+
+// Selected wraps fn so it's only called with the forests Select would pick,
+// for forests that are streamed in rather than held in a slice. Projects
+// are filtered too, so it's only for outputs, never for data that's saved.
+func (filter ForestFilterConfig) Selected(fn func(forest Forest) error) func(forest Forest) error {
+	selected := 0
+	return func(forest Forest) error {
+		if (filter.Limit > 0 && selected >= filter.Limit) || !filter.Matches(forest) {
+			return nil
+		}
+		selected++
+		return fn(filter.FilterProjects(forest))
+	}
+}
+
+// Select returns the indexes of the forests that match, in order
+func (filter ForestFilterConfig) Select(forests []Forest) []int {
+	indexes := []int{}
+	for i, forest := range forests {
+		if filter.Limit > 0 && len(indexes) >= filter.Limit {
+			break
+		}
+		if filter.Matches(forest) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Match confidences recorded on each snapshot. A snapshot that starts
+// a new project defines it, so it gets full confidence.
+const (
+	matchNepaId          = 1.0
+	matchNewProject      = 1.0
+	matchProjectCode     = 0.9
+	matchNameAndDistrict = 0.8
+	matchName            = 0.6
+	matchSimilarName     = 0.5
+
+	similarNameThreshold = 0.8
+)
+
+// AddUpdates files one edition's snapshots under their projects,
+// creating projects the first time they're seen. It returns the key
+// of each snapshot's project, in the same order as updates.
+func (forest *Forest) AddUpdates(updates []ProjectUpdate) []string {
+	keys := make([]string, len(updates))
+	claimed := map[string]bool{} // a project gets one snapshot per edition
+	for i, update := range updates {
+		project, confidence := forest.resolveProject(update, claimed)
+		if project == nil {
+			forest.Projects = append(forest.Projects, forest.newProject(update))
+			project = &forest.Projects[len(forest.Projects)-1]
+			confidence = matchNewProject
+		}
+
+		update.MatchConfidence = confidence
+		project.AddUpdate(update)
+		forest.upgradeId(project)
+		claimed[project.Key] = true
+		keys[i] = project.Key
+	}
+	return keys
+}
+
+// resolveProject finds the best existing project for the snapshot, in
+// order of NEPA id, project code, name and district, name alone, and
+// finally a similar name in the same district. Projects with a different
+// NEPA id, or already claimed by another row of this edition, never match.
+func (forest *Forest) resolveProject(update ProjectUpdate, claimed map[string]bool) (*Project, float64) {
+	var best *Project
+	bestConfidence := 0.0
+
+	name := normalizeProjectName(update.Name)
+	code := strings.ToLower(strings.TrimSpace(update.ProjectCode))
+	district := strings.ToLower(trim(update.District))
+
+	for i := range forest.Projects {
+		project := &forest.Projects[i]
+		if claimed[project.Key] {
+			continue
+		}
+		if update.Id != "" && project.Id != "" {
+			if update.Id == project.Id {
+				return project, matchNepaId
+			}
+			continue
+		}
+
+		current := project.Current()
+		confidence := 0.0
+		sameDistrict := district == strings.ToLower(trim(current.District))
+		switch {
+		case code != "" && code == strings.ToLower(strings.TrimSpace(current.ProjectCode)):
+			confidence = matchProjectCode
+		case name != "" && name == normalizeProjectName(current.Name) && sameDistrict:
+			confidence = matchNameAndDistrict
+		case name != "" && name == normalizeProjectName(current.Name):
+			confidence = matchName
+		case sameDistrict && nameSimilarity(name, normalizeProjectName(current.Name)) >= similarNameThreshold:
+			confidence = matchSimilarName
+		}
+
+		if confidence > bestConfidence {
+			best = project
+			bestConfidence = confidence
+		}
+	}
+
+	return best, bestConfidence
+}
+
+// newProject keys the project by its NEPA id, or by a synthetic id when
+// it has none. Synthetic ids are a hash of what identifies the project
+// within the forest, so the same crawl always produces the same ids.
+func (forest *Forest) newProject(update ProjectUpdate) Project {
+	if update.Id != "" && forest.Project(update.Id) == nil {
+		return Project{Key: update.Id}
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf(
+		"%d|%s|%s|%s",
+		forest.Id,
+		strings.ToLower(trim(update.District)),
+		strings.ToLower(strings.TrimSpace(update.ProjectCode)),
+		normalizeProjectName(update.Name),
+	)))
+	syntheticId := "syn-" + hex.EncodeToString(sum[:])[:12]
+
+	// rows that look identical but aren't the same project
+	key := syntheticId
+	for n := 2; forest.Project(key) != nil; n++ {
+		key = fmt.Sprintf("%s-%d", syntheticId, n)
+	}
+	return Project{Key: key, SyntheticId: key}
+}
+
+// upgradeId switches the project over to its NEPA id once
+// an edition links to one. The synthetic id is kept.
+func (forest *Forest) upgradeId(project *Project) {
+	if project.Id != "" && project.Key != project.Id && forest.Project(project.Id) == nil {
+		project.Key = project.Id
+	}
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// normalizeProjectName ignores case, punctuation and a trailing "project"
+func normalizeProjectName(name string) string {
+	name = nonAlphanumeric.ReplaceAllString(strings.ToLower(name), " ")
+	name = strings.TrimSpace(name)
+	name = strings.TrimSuffix(name, " project")
+	return name
+}
+
+// nameSimilarity is the share of words the two names have in common
+func nameSimilarity(a string, b string) float64 {
+	aWords, bWords := strings.Fields(a), strings.Fields(b)
+	if len(aWords) == 0 || len(bWords) == 0 {
+		return 0
+	}
+
+	words := map[string]int{}
+	for _, word := range aWords {
+		words[word] |= 1
+	}
+	for _, word := range bWords {
+		words[word] |= 2
+	}
+	shared := 0
+	for _, in := range words {
+		if in == 3 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(words))
+}
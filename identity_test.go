@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddUpdatesIdentity(t *testing.T) {
+	forest := Forest{Id: 110515}
+	july := forest.AddUpdates([]ProjectUpdate{
+		{Name: "Dinkey Creek Trail", District: "High Sierra", SopaReportDate: "2021-07"},
+		{Name: "Shaver Lake Fuels", Id: "50001", SopaReportDate: "2021-07"},
+		{Name: "Big Creek Thinning", ProjectCode: "BCT-1", District: "Bass Lake", SopaReportDate: "2021-07"},
+	})
+
+	synthetic := july[0]
+	if !strings.HasPrefix(synthetic, "syn-") {
+		t.Fatalf("project without a NEPA id keyed %q, want a synthetic id", synthetic)
+	}
+	if july[1] != "50001" {
+		t.Errorf("project with a NEPA id keyed %q, want 50001", july[1])
+	}
+
+	// the same crawl always makes the same synthetic ids
+	again := Forest{Id: 110515}
+	if key := again.AddUpdates([]ProjectUpdate{{Name: "Dinkey Creek Trail", District: "High Sierra"}})[0]; key != synthetic {
+		t.Errorf("synthetic id %q, want the stable %q", key, synthetic)
+	}
+
+	tests := []struct {
+		update     ProjectUpdate
+		key        string
+		confidence float64
+	}{
+		{ProjectUpdate{Name: "Shaver Lake Fuels Project", Id: "50001"}, "50001", matchNepaId},
+		{ProjectUpdate{Name: "Big Creek Thinning Phase 2", ProjectCode: "bct-1", District: "Bass Lake"}, july[2], matchProjectCode},
+		{ProjectUpdate{Name: "Dinkey Creek Trail Project", District: "High Sierra"}, synthetic, matchNameAndDistrict},
+	}
+	for _, test := range tests {
+		test.update.SopaReportDate = "2022-01"
+		key := forest.AddUpdates([]ProjectUpdate{test.update})[0]
+		if key != test.key {
+			t.Errorf("%q matched %q, want %q", test.update.Name, key, test.key)
+			continue
+		}
+		if confidence := forest.Project(key).Current().MatchConfidence; confidence != test.confidence {
+			t.Errorf("%q matched with confidence %v, want %v", test.update.Name, confidence, test.confidence)
+		}
+	}
+	if len(forest.Projects) != 3 {
+		t.Errorf("got %d projects, want 3: %+v", len(forest.Projects), forest.Projects)
+	}
+
+	// a different NEPA id is a different project, whatever the name
+	other := forest.AddUpdates([]ProjectUpdate{{Name: "Shaver Lake Fuels", Id: "50002", SopaReportDate: "2022-01"}})[0]
+	if other != "50002" {
+		t.Errorf("project with another NEPA id keyed %q, want 50002", other)
+	}
+}
+
+func TestAddUpdatesUpgradeId(t *testing.T) {
+	forest := Forest{Id: 110515}
+	synthetic := forest.AddUpdates([]ProjectUpdate{{Name: "Dinkey Creek Trail", District: "High Sierra", SopaReportDate: "2021-07"}})[0]
+
+	key := forest.AddUpdates([]ProjectUpdate{{Name: "Dinkey Creek Trail", Id: "60001", District: "High Sierra", SopaReportDate: "2022-01"}})[0]
+	if key != "60001" {
+		t.Fatalf("project keyed %q once linked to a NEPA id, want 60001", key)
+	}
+	project := forest.Project("60001")
+	if project.SyntheticId != synthetic {
+		t.Errorf("synthetic id %q, want %q kept", project.SyntheticId, synthetic)
+	}
+	if len(project.Updates) != 2 {
+		t.Errorf("updates = %+v, want both editions on one project", project.Updates)
+	}
+	if forest.Project(synthetic) != nil {
+		t.Errorf("project still reachable by its synthetic key")
+	}
+}
+
+func TestAddUpdatesIdenticalRows(t *testing.T) {
+	forest := Forest{Id: 110515}
+	row := ProjectUpdate{Name: "Roadside Hazard Trees", District: "High Sierra", SopaReportDate: "2021-07"}
+	keys := forest.AddUpdates([]ProjectUpdate{row, row})
+	if keys[0] == keys[1] {
+		t.Fatalf("identical rows of one edition share the key %q", keys[0])
+	}
+	if keys[1] != keys[0]+"-2" {
+		t.Errorf("second row keyed %q, want %q", keys[1], keys[0]+"-2")
+	}
+}
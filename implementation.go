@@ -0,0 +1,121 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DatePrecision is how exactly a SOPA date was given
+type DatePrecision string
+
+const (
+	PrecisionUnknown    DatePrecision = ""
+	PrecisionDay        DatePrecision = "day"
+	PrecisionMonth      DatePrecision = "month"
+	PrecisionQuarter    DatePrecision = "quarter"
+	PrecisionFiscalYear DatePrecision = "fiscal_year"
+)
+
+// ImplementationWindow is the range of days the expected implementation
+// column allows for, Earliest and Latest both inclusive
+type ImplementationWindow struct {
+	Earliest  time.Time     `json:"earliest"`
+	Latest    time.Time     `json:"latest"`
+	Precision DatePrecision `json:"precision"`
+}
+
+// Overlaps is whether implementation could start between from and to,
+// so "in the next 6 months" is Overlaps(now, now.AddDate(0, 6, 0))
+func (window ImplementationWindow) Overlaps(from time.Time, to time.Time) bool {
+	if window.Precision == PrecisionUnknown {
+		return false
+	}
+	return !window.Latest.Before(from) && !window.Earliest.After(to)
+}
+
+var (
+	dayPattern               = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})/(\d{4})$`)
+	monthPattern             = regexp.MustCompile(`^(\d{1,2})/(\d{4})$`)
+	fiscalQuarterPattern     = regexp.MustCompile(`^fy\s*'?(\d{2}|\d{4})\s*-?\s*q([1-4])$`)
+	quarterFiscalPattern     = regexp.MustCompile(`^q([1-4])\s*-?\s*fy\s*'?(\d{2}|\d{4})$`)
+	calendarQuarterPattern   = regexp.MustCompile(`^q([1-4])\s*-?\s*(\d{4})$`)
+	fiscalYearPattern        = regexp.MustCompile(`^fy\s*'?(\d{2}|\d{4})$`)
+	noImplementationPattern  = regexp.MustCompile(`^(none|n/?a|tbd|unknown|-*)$`)
+	implementationWhitespace = regexp.MustCompile(`\s+`)
+)
+
+// parseImplementationWindow reads the expected implementation column.
+// Federal fiscal years start October 1st of the year before, so FY2023
+// is October 2022 through September 2023 and FY2023 Q1 is October
+// through December 2022. The second return is false for text we can't
+// read, as opposed to text saying there's no date.
+func parseImplementationWindow(text string) (ImplementationWindow, bool) {
+	text = implementationWhitespace.ReplaceAllString(strings.ToLower(strings.TrimSpace(text)), " ")
+
+	if noImplementationPattern.MatchString(text) {
+		return ImplementationWindow{}, true
+	}
+	if m := dayPattern.FindStringSubmatch(text); m != nil {
+		day := implementationDate(m[3], m[1], 1).AddDate(0, 0, parseDigits(m[2])-1)
+		if day.Month() != time.Month(parseDigits(m[1])) {
+			return ImplementationWindow{}, false
+		}
+		return ImplementationWindow{day, day, PrecisionDay}, true
+	}
+	if m := monthPattern.FindStringSubmatch(text); m != nil {
+		if month := parseDigits(m[1]); month < 1 || month > 12 {
+			return ImplementationWindow{}, false
+		}
+		start := implementationDate(m[2], m[1], 1)
+		return ImplementationWindow{start, start.AddDate(0, 1, -1), PrecisionMonth}, true
+	}
+	if m := fiscalQuarterPattern.FindStringSubmatch(text); m != nil {
+		return fiscalQuarter(m[1], m[2]), true
+	}
+	if m := quarterFiscalPattern.FindStringSubmatch(text); m != nil {
+		return fiscalQuarter(m[2], m[1]), true
+	}
+	if m := calendarQuarterPattern.FindStringSubmatch(text); m != nil {
+		start := implementationDate(m[2], strconv.Itoa(3*parseDigits(m[1])-2), 1)
+		return ImplementationWindow{start, start.AddDate(0, 3, -1), PrecisionQuarter}, true
+	}
+	if m := fiscalYearPattern.FindStringSubmatch(text); m != nil {
+		start := implementationDate(strconv.Itoa(fiscalYear(m[1])-1), "10", 1)
+		return ImplementationWindow{start, start.AddDate(1, 0, -1), PrecisionFiscalYear}, true
+	}
+
+	return ImplementationWindow{}, false
+}
+
+func fiscalQuarter(year string, quarter string) ImplementationWindow {
+	start := implementationDate(strconv.Itoa(fiscalYear(year)-1), "10", 1).AddDate(0, 3*(parseDigits(quarter)-1), 0)
+	return ImplementationWindow{start, start.AddDate(0, 3, -1), PrecisionQuarter}
+}
+
+// fiscalYear reads "23" as 2023
+func fiscalYear(year string) int {
+	if len(year) == 2 {
+		return 2000 + parseDigits(year)
+	}
+	return parseDigits(year)
+}
+
+func implementationDate(year string, month string, day int) time.Time {
+	return time.Date(parseDigits(year), time.Month(parseDigits(month)), day, 0, 0, 0, 0, time.UTC)
+}
+
+// parseDigits is only used on strings the patterns matched as digits
+func parseDigits(digits string) int {
+	n, _ := strconv.Atoi(digits)
+	return n
+}
+
+// formatDate leaves unknown dates blank in exports
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
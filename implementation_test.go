@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestParseImplementationWindow(t *testing.T) {
+	tests := []struct {
+		text      string
+		earliest  string
+		latest    string
+		precision DatePrecision
+		ok        bool
+	}{
+		{"08/2022", "2022-08-01", "2022-08-31", PrecisionMonth, true},
+		{"08/15/2022", "2022-08-15", "2022-08-15", PrecisionDay, true},
+		// FY2023 runs October 2022 to September 2023
+		{"FY2023 Q2", "2023-01-01", "2023-03-31", PrecisionQuarter, true},
+		{"Q3 FY2024", "2024-04-01", "2024-06-30", PrecisionQuarter, true},
+		{"FY23", "2022-10-01", "2023-09-30", PrecisionFiscalYear, true},
+		{"None", "", "", PrecisionUnknown, true},
+		{"", "", "", PrecisionUnknown, true},
+		{"13/2022", "", "", PrecisionUnknown, false},
+		{"Spring 2023", "", "", PrecisionUnknown, false},
+	}
+
+	for _, test := range tests {
+		window, ok := parseImplementationWindow(test.text)
+		if ok != test.ok {
+			t.Errorf("parseImplementationWindow(%q) ok = %v, want %v", test.text, ok, test.ok)
+		}
+		if earliest := formatDate(window.Earliest); earliest != test.earliest {
+			t.Errorf("parseImplementationWindow(%q) earliest = %q, want %q", test.text, earliest, test.earliest)
+		}
+		if latest := formatDate(window.Latest); latest != test.latest {
+			t.Errorf("parseImplementationWindow(%q) latest = %q, want %q", test.text, latest, test.latest)
+		}
+		if window.Precision != test.precision {
+			t.Errorf("parseImplementationWindow(%q) precision = %q, want %q", test.text, window.Precision, test.precision)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Location is the project location row, split into its sections, e.g.
+// "UNIT - Sierra National Forest. STATE - California. COUNTY - Fresno,
+// Madera. LEGAL - T12N R3E Sec 4. Near Shaver Lake."
+type Location struct {
+	Units       []string           `json:"units"`
+	States      []State            `json:"states"`
+	Counties    []string           `json:"counties"`
+	Legal       string             `json:"legal"`
+	PLSS        []LegalDescription `json:"plss"`
+	Description string             `json:"description"`
+}
+
+// LegalDescription is a Public Land Survey System township and range,
+// with the sections within it when given
+type LegalDescription struct {
+	Township string `json:"township"` // e.g. "12N"
+	Range    string `json:"range"`    // e.g. "3E"
+	Sections []int  `json:"sections,omitempty"`
+	Meridian string `json:"meridian,omitempty"`
+}
+
+var (
+	locationSectionPattern = regexp.MustCompile(`\b(UNITS?|STATES?|COUNTY|COUNTIES|LEGAL)\s*-\s*`)
+	// anything else shaped like a header, to flag sections we don't know
+	locationHeaderShape = regexp.MustCompile(`\b([A-Z]{3,})\s+-\s`)
+
+	// a period ends a section unless it's after a PLSS abbreviation
+	locationSectionEnd = regexp.MustCompile(`\.(\s|$)`)
+	plssAbbreviation   = regexp.MustCompile(`(?i)(\b(t|r|sec|secs|mer|no)|\d[nsew])$`)
+
+	plssPattern = regexp.MustCompile(
+		`(?i)\bT\.?\s*(\d{1,3})\s*([NS])\.?,?\s*R\.?\s*(\d{1,3})\s*([EW])\.?,?` +
+			`(?:\s*(?:Sec(?:tion)?s?)\.?\s*((?:\d{1,2}(?:\s*(?:-|,|&|and)\s*)?)+))?` +
+			`(?:,?\s*([A-Za-z][A-Za-z ]*?)\s+(?:Meridian|Mer\.|PM)\b)?`)
+	sectionRangePattern = regexp.MustCompile(`(\d{1,2})(?:\s*-\s*(\d{1,2}))?`)
+	listSeparator       = regexp.MustCompile(`\s*(?:,|;|\band\b)\s*`)
+	notApplicable       = regexp.MustCompile(`(?i)^(not applicable|n/?a|none)?$`)
+)
+
+// parseLocation splits the location text into its sections. Text outside
+// any section is the description. The second return lists the parts that
+// couldn't be read, as field and raw text.
+func parseLocation(text string) (Location, [][2]string) {
+	location := Location{
+		Units:    []string{},
+		States:   []State{},
+		Counties: []string{},
+		PLSS:     []LegalDescription{},
+	}
+	problems := [][2]string{}
+	description := []string{}
+
+	for _, m := range locationHeaderShape.FindAllStringSubmatch(text, -1) {
+		if !locationSectionPattern.MatchString(m[0]) {
+			problems = append(problems, [2]string{"location_section", m[1]})
+		}
+	}
+
+	headers := locationSectionPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(headers) == 0 {
+		location.Description = trim(text)
+		return location, problems
+	}
+	description = append(description, text[:headers[0][0]])
+
+	for h, header := range headers {
+		end := len(text)
+		if h+1 < len(headers) {
+			end = headers[h+1][0]
+		}
+		content, rest := splitLocationSection(text[header[1]:end])
+		description = append(description, rest)
+
+		switch text[header[2]:header[3]] {
+		case "UNIT", "UNITS":
+			location.Units = append(location.Units, splitLocationList(content)...)
+		case "STATE", "STATES":
+			for _, name := range splitLocationList(content) {
+				state, err := ParseState(name)
+				if err != nil {
+					problems = append(problems, [2]string{"location_state", name})
+					continue
+				}
+				location.States = append(location.States, state)
+			}
+		case "COUNTY", "COUNTIES":
+			location.Counties = append(location.Counties, splitLocationList(content)...)
+		case "LEGAL":
+			location.Legal = content
+			if notApplicable.MatchString(content) {
+				continue
+			}
+			location.PLSS = append(location.PLSS, parsePLSS(content)...)
+			if len(location.PLSS) == 0 {
+				problems = append(problems, [2]string{"location_legal", content})
+			}
+		}
+	}
+
+	location.Description = trim(strings.Join(description, " "))
+	return location, problems
+}
+
+// splitLocationSection is the section's content, up to the first period
+// that ends a sentence, and whatever text follows it
+func splitLocationSection(text string) (string, string) {
+	for _, match := range locationSectionEnd.FindAllStringIndex(text, -1) {
+		if !plssAbbreviation.MatchString(text[:match[0]]) {
+			return trim(text[:match[0]]), text[match[1]:]
+		}
+	}
+	return trim(strings.TrimSuffix(trim(text), ".")), ""
+}
+
+func splitLocationList(text string) []string {
+	items := []string{}
+	for _, item := range listSeparator.Split(text, -1) {
+		if item = trim(item); item != "" && !notApplicable.MatchString(item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePLSS finds every township and range in the legal description,
+// like "T12N R3E Sec 4" or "T. 1 S., R. 2 W., Secs. 1-3, Mount Diablo Meridian"
+func parsePLSS(text string) []LegalDescription {
+	descriptions := []LegalDescription{}
+	for _, m := range plssPattern.FindAllStringSubmatch(text, -1) {
+		description := LegalDescription{
+			Township: strings.TrimLeft(m[1], "0") + strings.ToUpper(m[2]),
+			Range:    strings.TrimLeft(m[3], "0") + strings.ToUpper(m[4]),
+			Meridian: trim(m[6]),
+		}
+		for _, r := range sectionRangePattern.FindAllStringSubmatch(m[5], -1) {
+			from, _ := strconv.Atoi(r[1])
+			to := from
+			if r[2] != "" {
+				to, _ = strconv.Atoi(r[2])
+			}
+			for section := from; section <= to && section <= 36; section++ {
+				description.Sections = append(description.Sections, section)
+			}
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLocation(t *testing.T) {
+	california, err := ParseState("California")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text     string
+		location Location
+		problems [][2]string
+	}{
+		{
+			text: "LEGAL - T12N R3E Sec 4",
+			location: Location{
+				Units:    []string{},
+				States:   []State{},
+				Counties: []string{},
+				Legal:    "T12N R3E Sec 4",
+				PLSS:     []LegalDescription{{Township: "12N", Range: "3E", Sections: []int{4}}},
+			},
+			problems: [][2]string{},
+		},
+		{
+			text: "UNIT - Sierra National Forest. STATE - California. COUNTY - Fresno, Madera. LEGAL - T12N R3E Sec 4. Near Shaver Lake.",
+			location: Location{
+				Units:       []string{"Sierra National Forest"},
+				States:      []State{california},
+				Counties:    []string{"Fresno", "Madera"},
+				Legal:       "T12N R3E Sec 4",
+				PLSS:        []LegalDescription{{Township: "12N", Range: "3E", Sections: []int{4}}},
+				Description: "Near Shaver Lake.",
+			},
+			problems: [][2]string{},
+		},
+		{
+			text: "UNITS - Sierra National Forest, Sequoia National Forest. STATES - California. COUNTIES - Fresno, Madera and Tulare. LEGAL - Not Applicable. Forestwide.",
+			location: Location{
+				Units:       []string{"Sierra National Forest", "Sequoia National Forest"},
+				States:      []State{california},
+				Counties:    []string{"Fresno", "Madera", "Tulare"},
+				Legal:       "Not Applicable",
+				PLSS:        []LegalDescription{},
+				Description: "Forestwide.",
+			},
+			problems: [][2]string{},
+		},
+		{
+			text: "LEGAL - T. 1 S., R. 2 W., Secs. 1-3, Mount Diablo Meridian.",
+			location: Location{
+				Units:    []string{},
+				States:   []State{},
+				Counties: []string{},
+				Legal:    "T. 1 S., R. 2 W., Secs. 1-3, Mount Diablo Meridian",
+				PLSS:     []LegalDescription{{Township: "1S", Range: "2W", Sections: []int{1, 2, 3}, Meridian: "Mount Diablo"}},
+			},
+			problems: [][2]string{},
+		},
+		{
+			// unknown sections are kept in the description and reported
+			text: "STATE - Atlantis. DISTRICT - High Sierra.",
+			location: Location{
+				Units:       []string{},
+				States:      []State{},
+				Counties:    []string{},
+				PLSS:        []LegalDescription{},
+				Description: "DISTRICT - High Sierra.",
+			},
+			problems: [][2]string{{"location_section", "DISTRICT"}, {"location_state", "Atlantis"}},
+		},
+		{
+			text: "Near Shaver Lake",
+			location: Location{
+				Units:       []string{},
+				States:      []State{},
+				Counties:    []string{},
+				PLSS:        []LegalDescription{},
+				Description: "Near Shaver Lake",
+			},
+			problems: [][2]string{},
+		},
+	}
+
+	for _, test := range tests {
+		location, problems := parseLocation(test.text)
+		if !reflect.DeepEqual(location, test.location) {
+			t.Errorf("parseLocation(%q) = %+v, want %+v", test.text, location, test.location)
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("parseLocation(%q) problems = %q, want %q", test.text, problems, test.problems)
+		}
+	}
+}
@@ -1,34 +1,48 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+
 	"github.com/alecthomas/kong"
 )
 
 var cli struct {
-	ParseUpdates     ParseUpdatesConfig    `cmd help:"Pull current known data from file and parse for updates. If updates..."`
-	ParseAllProjects struct{}              `cmd help:"Parse all projects avaliable and save to JSON"`
-	UploadDocuments  UploadDocumentsConfig `cmd help:"TODO"`
-	ForestJsonToCsv  ForestJsonToCsvConfig `cmd help:"TODO(hank)"`
-	Quick            struct{}              `cmd`
+	ParseUpdates     ParseUpdatesConfig     `cmd help:"Pull current known data from file and parse for updates. If updates..."`
+	ParseAllProjects ParseAllProjectsConfig `cmd help:"Parse all projects avaliable and save to JSON"`
+	UploadDocuments  UploadDocumentsConfig  `cmd help:"TODO"`
+	ForestJsonToCsv  ForestJsonToCsvConfig  `cmd help:"TODO(hank)"`
+	ExportSqlite     ExportSqliteConfig     `cmd help:"Convert a forest data JSON snapshot to a SQLite database"`
+	Quick            struct{}               `cmd`
 }
 
 func main() {
-	ctx := kong.Parse(&cli)
+	kctx := kong.Parse(&cli)
+
+	// stop in-flight requests cleanly on ctrl-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	switch ctx.Command() {
+	var err error
+	switch kctx.Command() {
 	case "parse-updates":
-		ParseUpdates(cli.ParseUpdates)
+		err = ParseUpdates(ctx, cli.ParseUpdates)
 
 	case "parse-all-projects":
-		ParseAllProjects()
+		err = ParseAllProjects(ctx, cli.ParseAllProjects)
 
 	case "upload-documents":
-		UploadDocuments(cli.UploadDocuments)
+		err = UploadDocuments(ctx, cli.UploadDocuments)
 
 	case "forest-json-to-csv":
-		ForestJsonToCsv(cli.ForestJsonToCsv)
+		err = ForestJsonToCsv(cli.ForestJsonToCsv)
+
+	case "export-sqlite":
+		err = ExportSqlite(ctx, cli.ExportSqlite)
 
 	case "quick":
 
 	}
+	kctx.FatalIfErrorf(err)
 }
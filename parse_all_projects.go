@@ -1,18 +1,84 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func ParseAllProjects() error {
-	// Get list of forests
-	forests, err := GetForests()
+type ParseAllProjectsConfig struct {
+	Concurrency int    `help:"Number of forests crawled in parallel, and project document lists fetched in parallel across all of them" default:"4"`
+	Output      string `help:"Write the data set to this file instead of the store. Crawls of only some forests or purposes must, they aren't full snapshots" type:"path" placeholder:"FILE"`
+
+	ForestFilterConfig
+	CheckpointConfig
+	StoreConfig
+	SqliteConfig
+	CrawlConfig
+}
+
+func ParseAllProjects(ctx context.Context, config ParseAllProjectsConfig) error {
+	if config.SelectsForests() && config.Output == "" {
+		return errors.New("a crawl of only some forests would look like a full snapshot in the store, pass --output to write it to a file")
+	}
+	if len(config.Purpose) > 0 && config.Output == "" {
+		return errors.New("snapshots in the store keep every project, pass --output to write only projects with the purposes to a file")
+	}
+
+	store, err := config.OpenStore(storeDir)
 	if err != nil {
 		return err
 	}
+	fetcher, err := NewFetcher(config.CrawlConfig)
+	if err != nil {
+		return err
+	}
+	db, err := config.OpenSqlite(ctx)
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	checkpoint, err := openCheckpoint(config.StateDir)
+	if err != nil {
+		return err
+	}
+
+	// Get list of forests, resuming with the list the
+	// checkpointed crawl started with if there is one
+	var forests []Forest
+	if config.Resume {
+		forests, err = checkpoint.LoadForestList()
+		if err != nil {
+			return err
+		}
+	}
+	if forests == nil {
+		if err := checkpoint.Clear(); err != nil {
+			return err
+		}
+		forests, err = GetForests(ctx, fetcher)
+		if err != nil {
+			return err
+		}
+		if err := checkpoint.SaveForestList(forests); err != nil {
+			return err
+		}
+	}
+
+	selected := []Forest{}
+	for _, i := range config.Select(forests) {
+		selected = append(selected, forests[i])
+	}
+	forests = selected
 
 	log.WithFields(log.Fields{
 		"count": len(forests),
@@ -20,34 +86,188 @@ func ParseAllProjects() error {
 
 	// For each forest, get the links to the SOPA reports,
 	// then parse those pages for project updates
-	for i, forest := range forests {
-		forests[i] = GetAllForestData(forest)
-		if i > 2 {
-			break
+	resume := func(forest Forest) *Forest {
+		if !config.Resume {
+			return nil
+		}
+		done, err := checkpoint.LoadForest(forest)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"forest": forest.Name,
+				"state":  forest.State,
+				"error":  err.Error(),
+			}).Warn("Unable to read forest checkpoint, crawling again")
+			return nil
+		} else if done != nil {
+			log.WithFields(log.Fields{
+				"forest": forest.Name,
+				"state":  forest.State,
+			}).Info("Forest already checkpointed, skipping")
+		}
+		return done
+	}
+	saved := func(forest Forest) {
+		if err := checkpoint.SaveForest(forest); err != nil {
+			log.WithFields(log.Fields{
+				"forest": forest.Name,
+				"state":  forest.State,
+				"error":  err.Error(),
+			}).Error("Unable to checkpoint forest")
+		}
+	}
+	forests, errs := crawlForests(ctx, fetcher, db, forests, config.Concurrency, resume, saved)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for i, err := range errs {
+		if err != nil {
+			// not checkpointed so a resumed crawl tries it again
+			log.WithFields(log.Fields{
+				"forest": forests[i].Name,
+				"state":  forests[i].State,
+				"error":  err.Error(),
+			}).Warn("Forest incomplete, not checkpointing it")
 		}
 	}
 
-	return saveProjectsJson(forests)
+	summary := ParseIssueSummary{}
+	for _, forest := range forests {
+		summary.Add(forest, forest.Updates(), forest.ParseIssues)
+	}
+	summary.Log()
+
+	incomplete := 0
+	for _, err := range errs {
+		if err != nil {
+			incomplete++
+		}
+	}
+	dataset := newDataset(config.CrawlConfig, config.ForestFilterConfig, forests)
+	if config.Output != "" && len(config.Purpose) > 0 {
+		// the file is an export, not a snapshot, so it's filtered like one
+		for i := range dataset.Forests {
+			dataset.Forests[i] = config.FilterProjects(dataset.Forests[i])
+		}
+		dataset.Crawl.Filter.Purpose = config.Purpose
+	}
+	return finishCrawl(ctx, config, store, checkpoint, dataset, incomplete)
 }
 
-func GetAllForestData(forest Forest) Forest {
+// finishCrawl saves the data set, then clears the checkpoint so a later
+// --resume crawls everything again. The checkpoint is kept if saving fails
+// or some forests are incomplete, for --resume to pick up from.
+func finishCrawl(ctx context.Context, config ParseAllProjectsConfig, store Store, checkpoint *checkpoint, dataset Dataset, incomplete int) error {
+	if config.Output != "" {
+		err := writeFileAtomicWith(config.Output, func(w io.Writer) error {
+			return writeDataset(w, config.Output, dataset)
+		})
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"file": config.Output,
+		}).Info("Forest data set written")
+	} else {
+		date := time.Now().Format("2006-01-02")
+		if err := store.Save(ctx, date, dataset); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"date": date,
+		}).Info("Forest data set saved")
+	}
+
+	if incomplete > 0 {
+		log.WithFields(log.Fields{
+			"count": incomplete,
+		}).Warn("Some forests are incomplete, keeping the checkpoint for --resume")
+		return nil
+	}
+	return checkpoint.Clear()
+}
+
+// crawlForests crawls every forest, concurrency at a time, writing each
+// one crawled completely to db when there is one. resume can return a
+// forest an earlier run finished to use instead of crawling it, and done
+// is called with each forest crawled completely. Both may be nil. The
+// forests come back in the same order, with an error for each that's
+// incomplete.
+func crawlForests(
+	ctx context.Context,
+	fetcher *Fetcher,
+	db *sqliteDb,
+	forests []Forest,
+	concurrency int,
+	resume func(Forest) *Forest,
+	done func(Forest),
+) ([]Forest, []error) {
+	crawled := make([]Forest, len(forests))
+	errs := make([]error, len(forests))
+	documents := newSemaphore(concurrency)
+	runIndexed(concurrency, len(forests), func(i int) {
+		if resume != nil {
+			if finished := resume(forests[i]); finished != nil {
+				crawled[i] = *finished
+				return
+			}
+		}
+
+		forest, err := GetAllForestData(ctx, fetcher, forests[i], documents)
+		crawled[i] = forest
+		if err != nil {
+			errs[i] = err
+			return
+		}
+
+		if done != nil {
+			done(forest)
+		}
+		if db != nil {
+			if err := db.SaveForest(ctx, forest); err != nil {
+				log.WithFields(log.Fields{
+					"forest": forest.Name,
+					"state":  forest.State,
+					"error":  err.Error(),
+				}).Error("Unable to write forest to sqlite")
+			}
+		}
+	})
+	return crawled, errs
+}
+
+// GetAllForestData crawls every SOPA report for the forest. An error means
+// the forest is incomplete, and it should not be checkpointed as done.
+// Document lists are fetched in parallel, as many at once as documents
+// allows, which is shared by every forest being crawled.
+func GetAllForestData(ctx context.Context, fetcher *Fetcher, forest Forest, documents semaphore) (Forest, error) {
 	log.WithFields(log.Fields{
 		"forest": forest.Name,
 		"state":  forest.State,
 	}).Info("Looking for projects")
 
-	projectPages, err := GetSopaReportPages(forest.Url)
+	projectPages, err := GetSopaReportPages(ctx, fetcher, fetcher.Crawl.ForestUrl(forest))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"forest": forest.Name,
 			"state":  forest.State,
 			"error":  err.Error(),
 		}).Error("Issue getting list of SOPA report urls")
-		return forest
+		return forest, err
 	}
 
+	// oldest first, so projects are identified the same
+	// way parse-updates would have as each edition came out
+	sort.SliceStable(projectPages, func(a, b int) bool {
+		return GetSopaReportDateFromURL(projectPages[a]) < GetSopaReportDateFromURL(projectPages[b])
+	})
+
+	// keep going past a bad page to log them all, but the
+	// forest isn't complete so it's returned as an error
+	failed := []string{}
 	for _, projectPage := range projectPages {
-		projects, err := getProjects(projectPage)
+		projects, pageIssues, err := getProjects(ctx, fetcher, projectPage)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"forest": forest.Name,
@@ -55,8 +275,12 @@ func GetAllForestData(forest Forest) Forest {
 				"page":   projectPage,
 				"error":  err.Error(),
 			}).Error("Issue getting projects")
+			failed = append(failed, projectPage)
+			continue
 		}
-		forest.Projects = append(forest.Projects, projects...)
+		forest.AddUpdates(projects)
+		forest.AddSopaReport(projectPage)
+		forest.ParseIssues = append(forest.ParseIssues, pageIssues...)
 	}
 
 	log.WithFields(log.Fields{
@@ -65,40 +289,37 @@ func GetAllForestData(forest Forest) Forest {
 		"count":  len(forest.Projects),
 	}).Info("Found projects")
 
-	for j := range forest.Projects {
-		if len(forest.Projects[j].Id) > 0 {
+	runIndexed(cap(documents), len(forest.Projects), func(j int) {
+		if len(forest.Projects[j].Id) == 0 {
+			return
+		}
+		documents.acquire()
+		defer documents.release()
+
+		log.WithFields(log.Fields{
+			"forest":  forest.Name,
+			"state":   forest.State,
+			"project": forest.Projects[j].Name,
+		}).Info("Getting documents")
+
+		docs, err := getReportDocumentMeta(ctx, fetcher, forest.Projects[j].Id)
+		if err != nil {
 			log.WithFields(log.Fields{
 				"forest":  forest.Name,
 				"state":   forest.State,
 				"project": forest.Projects[j].Name,
-			}).Info("Getting documents")
-
-			docs, err := getReportDocumentMeta(forest.Projects[j].Id)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"forest":  forest.Name,
-					"state":   forest.State,
-					"project": forest.Projects[j].Name,
-				}).Error("Issue getting documents")
-				continue
-			}
-
-			forest.Projects[j].ProjectDocuments = append(
-				forest.Projects[j].ProjectDocuments,
-				docs...,
-			)
-
+			}).Error("Issue getting documents")
+			return
 		}
-	}
 
-	return forest
-}
+		forest.Projects[j].AddDocuments(docs)
+	})
 
-func saveProjectsJson(forests []Forest) error {
-	data, err := json.Marshal(forests)
-	if err != nil {
-		return err
+	if ctx.Err() != nil {
+		return forest, ctx.Err()
 	}
-
-	return ioutil.WriteFile("data/forests.json", data, 0644)
+	if len(failed) > 0 {
+		return forest, fmt.Errorf("unable to get %d of %d SOPA reports for %s: %s", len(failed), len(projectPages), forest.Name, strings.Join(failed, ", "))
+	}
+	return forest, nil
 }
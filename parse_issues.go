@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ParseIssue is something on a SOPA report page we couldn't make
+// sense of. The row is kept with whatever parsed, and the issue is
+// recorded so the page can be looked at later.
+type ParseIssue struct {
+	PageUrl string `json:"page_url"`
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Raw     string `json:"raw"`
+	Reason  string `json:"reason"`
+}
+
+// ParseIssueSummary counts issues by field for each forest
+// so a run can report where the parser is struggling
+type ParseIssueSummary struct {
+	forests []summaryForest
+	counts  []map[string]int
+}
+
+// summaryForest is just enough to tell forests apart, the rest
+// of the forest is already in the data set
+type summaryForest struct {
+	id   int
+	name string
+}
+
+// Add counts the issues, adding to the forest's earlier counts if any
+func (summary *ParseIssueSummary) Add(forest Forest, projects []ProjectUpdate, pageIssues []ParseIssue) {
+	key := summaryForest{id: forest.Id, name: forest.Name}
+	index := -1
+	for i, added := range summary.forests {
+		if added == key {
+			index = i
+		}
+	}
+	if index < 0 {
+		summary.forests = append(summary.forests, key)
+		summary.counts = append(summary.counts, map[string]int{})
+		index = len(summary.forests) - 1
+	}
+
+	counts := summary.counts[index]
+	for _, issue := range pageIssues {
+		counts[issue.Field]++
+	}
+	for _, project := range projects {
+		for _, issue := range project.Issues {
+			counts[issue.Field]++
+		}
+	}
+}
+
+func (summary *ParseIssueSummary) Log() {
+	total := 0
+	for i, counts := range summary.counts {
+		if len(counts) == 0 {
+			continue
+		}
+
+		fields := log.Fields{
+			"forest":    summary.forests[i].name,
+			"forest_id": summary.forests[i].id,
+		}
+		forestTotal := 0
+		for field, count := range counts {
+			forestTotal += count
+			key := issueFieldKey(field)
+			if earlier, ok := fields[key].(int); ok {
+				count += earlier
+			}
+			fields[key] = count
+		}
+		fields["count"] = forestTotal
+		total += forestTotal
+
+		log.WithFields(fields).Warn("Parse issues")
+	}
+
+	log.WithFields(log.Fields{
+		"count": total,
+	}).Info("Parse issues total")
+}
+
+// issueFieldKey turns an issue's field, like "column 3", into
+// a log field key without spaces, like field_column_3
+func issueFieldKey(field string) string {
+	words := strings.FieldsFunc(strings.ToLower(field), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(append([]string{"field"}, words...), "_")
+}
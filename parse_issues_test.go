@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestIssueFieldKey(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"state", "field_state"},
+		{"column 3", "field_column_3"},
+		{"Expected Implementation", "field_expected_implementation"},
+		{" contact / phone ", "field_contact_phone"},
+		{"", "field"},
+	}
+
+	for _, test := range tests {
+		if got := issueFieldKey(test.field); got != test.want {
+			t.Errorf("issueFieldKey(%q) = %q, want %q", test.field, got, test.want)
+		}
+	}
+}
+
+func TestParseIssueSummaryAdd(t *testing.T) {
+	forest := Forest{Id: 110519, Name: "Tahoe National Forest"}
+	summary := ParseIssueSummary{}
+	summary.Add(forest, []ProjectUpdate{{Issues: []ParseIssue{{Field: "column 3"}}}}, []ParseIssue{{Field: "state"}})
+	forest.Projects = []Project{{Key: "50001"}}
+	summary.Add(forest, nil, []ParseIssue{{Field: "column 3"}})
+
+	if len(summary.forests) != 1 || summary.forests[0] != (summaryForest{id: 110519, name: "Tahoe National Forest"}) {
+		t.Fatalf("forests = %+v, want just the one", summary.forests)
+	}
+	if got := summary.counts[0]; got["column 3"] != 2 || got["state"] != 1 {
+		t.Errorf("counts = %v, want column 3 twice and state once", got)
+	}
+}
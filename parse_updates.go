@@ -2,18 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"sort"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,133 +17,139 @@ import (
  * Parse just the updates
  */
 type ParseUpdatesConfig struct {
-	AccessKeyId     string `env required help:"AWS Access Key ID" type:"string"`
-	SecretAccessKey string `env required help:"AWS Secret Access Key" type:"string"`
-	RegionId        string `env required help:"AWS Region ID" type:"string"`
-	BucketName      string `help:"S3 bucket that files will be uploaded to" type:"string"`
-	SlackHookUrl    string `env required`
+	SlackHookUrl string `env help:"Slack webhook new SOPA reports are posted to, nothing is posted when empty"`
+	Since        string `help:"Re-ingest SOPA reports from this month on, even ones we already have" placeholder:"YYYY-MM"`
+	Bootstrap    bool   `help:"When the store has no data set yet, seed it with a full crawl of every forest"`
+	Concurrency  int    `help:"Number of forests crawled in parallel when bootstrapping" default:"4"`
+
+	SnapshotEvery time.Duration `help:"Save a full snapshot when the latest is at least this old, otherwise only a change set. 0 for every run" default:"168h"`
+
+	ForestFilterConfig
+	StoreConfig
+	SqliteConfig
+	CrawlConfig
 }
 
-func ParseUpdates(config ParseUpdatesConfig) error {
-	// Setup AWS
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(config.RegionId),
-		Credentials: credentials.NewStaticCredentials(
-			config.AccessKeyId,
-			config.SecretAccessKey,
-			"",
-		),
-	})
+func ParseUpdates(ctx context.Context, config ParseUpdatesConfig) error {
+	if config.Since != "" {
+		if _, err := time.Parse("2006-01", config.Since); err != nil {
+			return fmt.Errorf("--since must look like YYYY-MM: %w", err)
+		}
+	}
+
+	store, err := config.OpenStore(storeS3)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-		}).Error("Unable to setup AWS Session")
 		return err
 	}
-
-	s3Service := s3.New(sess, &aws.Config{})
-	uploader := s3manager.NewUploader(sess)
-
-	forests, err := getMostRecentDataSet(s3Service, config.BucketName)
+	fetcher, err := NewFetcher(config.CrawlConfig)
+	if err != nil {
+		return err
+	}
+	db, err := config.OpenSqlite(ctx)
 	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	// the latest snapshot with the change sets since applied
+	dataset, date, err := loadCurrent(ctx, store)
+	if errors.Is(err, ErrNoSnapshots) {
+		if !config.Bootstrap {
+			return fmt.Errorf("%w, run with --bootstrap to seed it with a full crawl", err)
+		}
+		return bootstrapStore(ctx, config, fetcher, store, db)
+	} else if err != nil {
 		log.WithFields(log.Fields{
 			"error": err.Error(),
 		}).Error("Unable to get most recent data set")
 		return err
 	}
+	forests := dataset.Forests
+
+	log.WithFields(log.Fields{
+		"date": date,
+	}).Info("Found most recent forest data set")
 
 	anyUpdates := false
-	for i, forest := range forests {
-		// Figure out if a new SOPA Report has been relaesed
-		// if so this will return the link to it's projects page
-		hasNewData, newSopaReportLink, err := checkForUpdates(forest)
+	// copies of the forests from before they're updated, to diff against
+	before := []Forest{}
+	changed := []int{}
+	reports := map[int][]string{}
+	summary := ParseIssueSummary{}
+	for _, i := range config.Select(forests) {
+		forest := forests[i]
+
+		// Figure out which SOPA Reports we don't have yet,
+		// oldest first so projects stay in date order
+		newSopaReportLinks, err := findMissingSopaReports(ctx, fetcher, forest, config.Since)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"forest": forest.Name,
 				"state":  forest.State,
-			}).Info("Error getting list of SOPA reports for forest")
-			return err
-		} else if !hasNewData {
+				"error":  err.Error(),
+			}).Error("Error getting list of SOPA reports for forest")
+			continue
+		} else if len(newSopaReportLinks) == 0 {
 			log.WithFields(log.Fields{
 				"forest": forest.Name,
 				"state":  forest.State,
 			}).Info("Forest data up to date")
 			continue
 		}
-		anyUpdates = hasNewData || anyUpdates
-
-		// if error, log, but do not fail
-		message := fmt.Sprintf(
-			"Found new <%s|SOPA Report> for *%s* forest in *%s*",
-			newSopaReportLink,
-			forest.Name,
-			forest.State,
-		)
-		err = sendSlackUpdate(config.SlackHookUrl, message)
+		anyUpdates = true
+
+		clone, err := cloneForest(forest)
 		if err != nil {
-			log.WithFields(log.Fields{
-				"message": message,
-				"link":    config.SlackHookUrl,
-			}).Error("Issue posting update to slack")
+			return err
 		}
+		before = append(before, clone)
+		changed = append(changed, i)
 
-		log.WithFields(log.Fields{
-			"forest": forest.Name,
-			"state":  forest.State,
-			"link":   newSopaReportLink,
-		}).Info("Found new SOPA Report for forest")
-
-		// Get projects
-		newProjects, err := getProjects(newSopaReportLink)
-		if err != nil {
+		for _, newSopaReportLink := range newSopaReportLinks {
 			log.WithFields(log.Fields{
 				"forest": forest.Name,
 				"state":  forest.State,
-				"page":   newSopaReportLink,
-				"error":  err.Error(),
-			}).Error("Issue getting projects")
-			continue
-		}
-
-		log.WithFields(log.Fields{
-			"forest": forest.Name,
-			"state":  forest.State,
-			"count":  len(newProjects),
-			"link":   newSopaReportLink,
-		}).Info("Parsed new projects")
+				"link":   newSopaReportLink,
+			}).Info("Found new SOPA Report for forest")
 
-		// Get all the documents for that new project
-		for j := range newProjects {
-			if len(newProjects[j].Id) > 0 {
-				log.WithFields(log.Fields{
-					"forest":  forest.Name,
-					"state":   forest.State,
-					"project": newProjects[j].Name,
-				}).Info("Getting documents")
+			newProjects, pageIssues, err := getNewProjects(ctx, fetcher, forest, newSopaReportLink)
+			if err != nil {
+				continue
+			}
 
-				docs, err := getReportDocumentMeta(newProjects[j].Id)
+			// if error, log, but do not fail
+			if message, ok := newSopaReportMessage(config.ForestFilterConfig, forest, newSopaReportLink, newProjects); ok {
+				err = sendSlackUpdate(config.SlackHookUrl, message)
 				if err != nil {
 					log.WithFields(log.Fields{
-						"forest":  forest.Name,
-						"state":   forest.State,
-						"project": newProjects[j].Name,
-					}).Error("Issue getting documents")
-					continue
+						"message": message,
+						"link":    config.SlackHookUrl,
+					}).Error("Issue posting update to slack")
 				}
+			}
 
-				uploadProjectToAirtable()
-
-				newProjects[j].ProjectDocuments = append(
-					newProjects[j].ProjectDocuments,
-					docs...,
-				)
+			// Add new snapshots to their projects, replacing the edition if it's being re-ingested
+			keys := forests[i].AddUpdates(newProjects)
+			getNewDocuments(ctx, fetcher, &forests[i], keys)
+			forests[i].ParseIssues = append(forests[i].ParseIssues, pageIssues...)
+			forests[i].AddSopaReport(newSopaReportLink)
+			reports[forest.Id] = append(reports[forest.Id], newSopaReportLink)
+			summary.Add(forest, newProjects, pageIssues)
+		}
 
+		if db != nil {
+			if err := db.SaveForest(ctx, forests[i]); err != nil {
+				log.WithFields(log.Fields{
+					"forest": forest.Name,
+					"state":  forest.State,
+					"error":  err.Error(),
+				}).Error("Unable to write forest to sqlite")
 			}
 		}
-
-		// Add new projects to forest
-		forests[i].Projects = append(newProjects, forests[i].Projects...)
 	}
+	summary.Log()
 
 	if !anyUpdates {
 		message := "No new SOPA Reports found"
@@ -162,106 +164,229 @@ func ParseUpdates(config ParseUpdatesConfig) error {
 		return nil
 	}
 
-	data, err := json.Marshal(forests)
+	now := time.Now()
+	after := []Forest{}
+	for _, i := range changed {
+		after = append(after, forests[i])
+	}
+	changes, err := diffForests(before, after, reports)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-		}).Error("Issue marshaling forest data json")
 		return err
 	}
+	if len(changes) > 0 {
+		changeSet := ChangeSet{
+			Id:            newChangeSetId(now),
+			SchemaVersion: datasetSchemaVersion,
+			GeneratedAt:   now.UTC(),
+			ToolVersion:   toolVersion(),
+			BaseSnapshot:  date,
+			Forests:       changes,
+		}
+		if err := store.SaveChangeSet(ctx, changeSet); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Error("Issue saving change set")
+			return err
+		}
 
-	file := fmt.Sprintf(
-		"%s.json",
-		time.Now().Format("2006-01-02"),
-	)
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		Body:   bytes.NewReader(data),
-		Key:    aws.String(file),
-		Bucket: aws.String(config.BucketName),
-	})
-	if err != nil {
+		log.WithFields(log.Fields{
+			"id":    changeSet.Id,
+			"count": len(changes),
+		}).Info("Change set successfully saved")
+	}
+
+	if !snapshotDue(date, now, config.SnapshotEvery) {
+		return nil
+	}
+
+	dataset = newDataset(config.CrawlConfig, config.ForestFilterConfig, forests)
+	dataset.Crawl.Since = config.Since
+	date = now.Format("2006-01-02")
+	if err := store.Save(ctx, date, dataset); err != nil {
 		log.WithFields(log.Fields{
 			"error": err.Error(),
-		}).Error("Issue writing new forest json data to S3")
+		}).Error("Issue saving new forest data set")
 		return err
 	}
 
 	log.WithFields(log.Fields{
-		"file": file,
-	}).Info("File with new forest data successfully written to S3")
+		"date": date,
+	}).Info("New forest data set successfully saved")
 
 	return nil
 }
 
-func getMostRecentDataSet(s3Service *s3.S3, bucketName string) ([]Forest, error) {
-	// TODO(gasparovic): list bucket elements and get the one with the greatest time stamp
-	listObjectsOutput, err := s3Service.ListObjects(&s3.ListObjectsInput{
-		Bucket: &bucketName,
-		Prefix: aws.String(""),
-	})
+// snapshotDue is whether the snapshot from date is at least `every` old
+func snapshotDue(date string, now time.Time, every time.Duration) bool {
+	taken, err := time.ParseInLocation("2006-01-02", date, now.Location())
 	if err != nil {
-		return nil, err
+		return true
+	}
+	return now.Sub(taken) >= every
+}
+
+// bootstrapStore seeds an empty store with a full crawl, the same
+// crawl parse-all-projects does, without checkpoints
+func bootstrapStore(ctx context.Context, config ParseUpdatesConfig, fetcher *Fetcher, store Store, db *sqliteDb) error {
+	if config.SelectsForests() {
+		// the seed is the base every later run's change sets apply to
+		return errors.New("bootstrapping needs a crawl of every forest, run it without forest filters")
 	}
+	log.Info("Store has no data set yet, bootstrapping with a full crawl")
 
-	mostRecentFile := *listObjectsOutput.Contents[0].Key
-	for _, content := range listObjectsOutput.Contents[1:] {
-		if mostRecentFile < *content.Key {
-			mostRecentFile = *content.Key
+	forests, err := GetForests(ctx, fetcher)
+	if err != nil {
+		return err
+	}
+
+	forests, errs := crawlForests(ctx, fetcher, db, forests, config.Concurrency, nil, nil)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for i, err := range errs {
+		if err != nil {
+			// a partial seed would look complete to every later run
+			return fmt.Errorf("bootstrap crawl failed for %s, not saving: %w", forests[i].Name, err)
 		}
+	}
 
+	summary := ParseIssueSummary{}
+	for _, forest := range forests {
+		summary.Add(forest, forest.Updates(), forest.ParseIssues)
+	}
+	summary.Log()
+
+	dataset := newDataset(config.CrawlConfig, config.ForestFilterConfig, forests)
+	date := time.Now().Format("2006-01-02")
+	if err := store.Save(ctx, date, dataset); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Seeded empty store with a full crawl of %d forests", len(forests))
+	if err := sendSlackUpdate(config.SlackHookUrl, message); err != nil {
+		log.WithFields(log.Fields{
+			"message": message,
+			"link":    config.SlackHookUrl,
+		}).Error("Issue posting update to slack")
 	}
 
 	log.WithFields(log.Fields{
-		"file":   mostRecentFile,
-		"bucket": bucketName,
-	}).Info("Found most recent forest data file")
+		"date":  date,
+		"count": len(forests),
+	}).Info("Bootstrapped store with a full crawl")
+	return nil
+}
 
-	getObjectOutput, err := s3Service.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(mostRecentFile),
-	})
+// findMissingSopaReports returns the links to every SOPA report listed for
+// the forest whose date isn't in the saved data, sorted oldest first.
+// Reports from since (YYYY-MM) on are returned even if we already have them.
+func findMissingSopaReports(ctx context.Context, fetcher *Fetcher, forest Forest, since string) ([]string, error) {
+	// Get list of sopa reports from USFS
+	pages, err := GetSopaReportPages(ctx, fetcher, fetcher.Crawl.ForestUrl(forest))
 	if err != nil {
 		return nil, err
 	}
 
-	bytes, err := ioutil.ReadAll(getObjectOutput.Body)
-	if err != nil {
-		return nil, err
+	// get reports from saved data
+	sopaReportDatesFromSavedData := forest.SopaReportDates()
+
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, page := range pages {
+		date := GetSopaReportDateFromURL(page)
+		if seen[date] {
+			continue
+		}
+		seen[date] = true
+
+		i := sort.SearchStrings(sopaReportDatesFromSavedData, date)
+		saved := i < len(sopaReportDatesFromSavedData) && sopaReportDatesFromSavedData[i] == date
+		if !saved || (since != "" && date >= since) {
+			missing = append(missing, page)
+		}
 	}
 
-	data := []Forest{}
-	err = json.Unmarshal(bytes, &data)
-	return data, err
+	sort.SliceStable(missing, func(a, b int) bool {
+		return GetSopaReportDateFromURL(missing[a]) < GetSopaReportDateFromURL(missing[b])
+	})
+	return missing, nil
 }
 
-func checkForUpdates(forest Forest) (bool, string, error) {
-	// Get list of sopa reports from USFS
-	pages, err := GetSopaReportPages(forest.Url)
+// getNewProjects parses a SOPA report
+func getNewProjects(ctx context.Context, fetcher *Fetcher, forest Forest, sopaReportLink string) ([]ProjectUpdate, []ParseIssue, error) {
+	newProjects, pageIssues, err := getProjects(ctx, fetcher, sopaReportLink)
 	if err != nil {
-		return false, "", err
+		log.WithFields(log.Fields{
+			"forest": forest.Name,
+			"state":  forest.State,
+			"page":   sopaReportLink,
+			"error":  err.Error(),
+		}).Error("Issue getting projects")
+		return nil, nil, err
 	}
 
-	// get most recent report from USFS website
-	sopaReportDatesFromUsfs := []string{}
-	for _, page := range pages {
-		sopaReportDatesFromUsfs = append(sopaReportDatesFromUsfs, GetSopaReportDateFromURL(page))
-	}
-	sort.Strings(sopaReportDatesFromUsfs)
-	mostRecentSopaReportFromUsfs := sopaReportDatesFromUsfs[len(sopaReportDatesFromUsfs)-1]
+	log.WithFields(log.Fields{
+		"forest": forest.Name,
+		"state":  forest.State,
+		"count":  len(newProjects),
+		"link":   sopaReportLink,
+	}).Info("Parsed new projects")
+
+	return newProjects, pageIssues, nil
+}
 
-	// get most recent report from saved data
-	sopaReportDatesFromSavedData := []string{}
-	for _, project := range forest.Projects {
-		sopaReportDatesFromSavedData = insert(sopaReportDatesFromSavedData, project.SopaReportDate)
+// newSopaReportMessage is the slack message for a new SOPA report. With
+// project filters only reports with matching projects are posted, the
+// saved data set still has every project.
+func newSopaReportMessage(filter ForestFilterConfig, forest Forest, sopaReportLink string, newProjects []ProjectUpdate) (string, bool) {
+	message := fmt.Sprintf(
+		"Found new <%s|SOPA Report> for *%s* forest in *%s*",
+		sopaReportLink,
+		forest.Name,
+		forest.State,
+	)
+	if len(filter.Purpose) == 0 {
+		return message, true
 	}
-	sort.Strings(sopaReportDatesFromSavedData)
-	mostRecentSopaReportFromSavedData := sopaReportDatesFromSavedData[len(sopaReportDatesFromSavedData)-1]
 
-	if mostRecentSopaReportFromUsfs <= mostRecentSopaReportFromSavedData {
-		return false, "", nil
+	matching := 0
+	for _, project := range newProjects {
+		if filter.MatchesProject(project) {
+			matching++
+		}
 	}
+	return fmt.Sprintf("%s with %d matching projects", message, matching), matching > 0
+}
 
-	return true, pages[0], nil
+// getNewDocuments gets all the documents for the projects
+// that have new snapshots
+func getNewDocuments(ctx context.Context, fetcher *Fetcher, forest *Forest, keys []string) {
+	for _, key := range keys {
+		project := forest.Project(key)
+		if project == nil || len(project.Id) == 0 {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"forest":  forest.Name,
+			"state":   forest.State,
+			"project": project.Name,
+		}).Info("Getting documents")
+
+		docs, err := getReportDocumentMeta(ctx, fetcher, project.Id)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"forest":  forest.Name,
+				"state":   forest.State,
+				"project": project.Name,
+			}).Error("Issue getting documents")
+			continue
+		}
+
+		uploadProjectToAirtable()
+
+		project.AddDocuments(docs)
+	}
 }
 
 func insert(arr []string, elm string) []string {
@@ -287,6 +412,10 @@ type SlackMessage struct {
 }
 
 func sendSlackUpdate(slackHookUrl string, message string) error {
+	if slackHookUrl == "" {
+		return nil
+	}
+
 	data, err := json.Marshal(SlackMessage{
 		Type: "mrkdwn",
 		Text: message,
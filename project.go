@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Project is one NEPA project as it appears across SOPA editions.
+// Updates holds a snapshot of the project from every edition it
+// was listed in, oldest first, at most one per SopaReportDate.
+// Key is the NEPA id, or a synthetic id until an edition links to one.
+type Project struct {
+	Key         string            `json:"key"`
+	Id          string            `json:"id"`
+	SyntheticId string            `json:"synthetic_id,omitempty"`
+	Name        string            `json:"name"`
+	Updates     []ProjectUpdate   `json:"updates"`
+	Documents   []ProjectDocument `json:"project_documents"`
+}
+
+// Current is the project as listed in the newest edition
+func (project Project) Current() ProjectUpdate {
+	if len(project.Updates) == 0 {
+		return ProjectUpdate{}
+	}
+	return project.Updates[len(project.Updates)-1]
+}
+
+// Update returns the snapshot from the given edition, or nil
+func (project *Project) Update(sopaReportDate string) *ProjectUpdate {
+	for i := range project.Updates {
+		if project.Updates[i].SopaReportDate == sopaReportDate {
+			return &project.Updates[i]
+		}
+	}
+	return nil
+}
+
+// AddUpdate adds the snapshot in date order. A snapshot from an
+// edition we already have replaces it, so editions can be re-ingested.
+func (project *Project) AddUpdate(update ProjectUpdate) {
+	i := sort.Search(len(project.Updates), func(i int) bool {
+		return project.Updates[i].SopaReportDate >= update.SopaReportDate
+	})
+	if i < len(project.Updates) && project.Updates[i].SopaReportDate == update.SopaReportDate {
+		project.Updates[i] = update
+	} else {
+		project.Updates = append(project.Updates, ProjectUpdate{})
+		copy(project.Updates[i+1:], project.Updates[i:])
+		project.Updates[i] = update
+	}
+
+	project.Name = project.Current().Name
+	if project.Id == "" && update.Id != "" {
+		project.Id = update.Id
+	}
+}
+
+// AddDocuments adds the documents we don't have yet, by url
+func (project *Project) AddDocuments(docs []ProjectDocument) {
+	have := map[string]bool{}
+	for _, doc := range project.Documents {
+		have[doc.Url] = true
+	}
+	for _, doc := range docs {
+		if !have[doc.Url] {
+			project.Documents = append(project.Documents, doc)
+			have[doc.Url] = true
+		}
+	}
+}
+
+// Project returns the forest's project with the key, or nil
+func (forest *Forest) Project(key string) *Project {
+	for i := range forest.Projects {
+		if forest.Projects[i].Key == key {
+			return &forest.Projects[i]
+		}
+	}
+	return nil
+}
+
+// AddSopaReport records that the report at url was ingested, even if it
+// listed no projects, so it isn't fetched again. Reports stay date ordered.
+func (forest *Forest) AddSopaReport(url string) {
+	for _, report := range forest.SopaReports {
+		if report == url {
+			return
+		}
+	}
+	forest.SopaReports = append(forest.SopaReports, url)
+	sort.SliceStable(forest.SopaReports, func(a, b int) bool {
+		return GetSopaReportDateFromURL(forest.SopaReports[a]) < GetSopaReportDateFromURL(forest.SopaReports[b])
+	})
+}
+
+// SopaReportDates is the dates of every report we have, from the recorded
+// reports and, for data saved before they were recorded, the snapshots
+func (forest Forest) SopaReportDates() []string {
+	dates := []string{}
+	for _, report := range forest.SopaReports {
+		dates = insert(dates, GetSopaReportDateFromURL(report))
+	}
+	for _, project := range forest.Projects {
+		for _, update := range project.Updates {
+			dates = insert(dates, update.SopaReportDate)
+		}
+	}
+	return dates
+}
+
+// Updates flattens every project's snapshots
+func (forest Forest) Updates() []ProjectUpdate {
+	updates := []ProjectUpdate{}
+	for _, project := range forest.Projects {
+		updates = append(updates, project.Updates...)
+	}
+	return updates
+}
+
+// legacyProjectUpdate is how snapshots were saved before projects
+// were split out, each one carrying its own copy of the documents
+type legacyProjectUpdate struct {
+	ProjectUpdate
+	ProjectDocuments []ProjectDocument `json:"project_documents"`
+}
+
+// UnmarshalJSON decodes both halves, ProjectUpdate's
+// own UnmarshalJSON would otherwise skip the documents
+func (update *legacyProjectUpdate) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &update.ProjectUpdate); err != nil {
+		return err
+	}
+	var documents struct {
+		ProjectDocuments []ProjectDocument `json:"project_documents"`
+	}
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return err
+	}
+	update.ProjectDocuments = documents.ProjectDocuments
+	return nil
+}
+
+// UnmarshalJSON also loads data sets saved when Forest.Projects was a
+// flat list of snapshots, converting them into projects
+func (forest *Forest) UnmarshalJSON(data []byte) error {
+	type plainForest Forest
+	var raw struct {
+		plainForest
+		Projects []json.RawMessage `json:"projects"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*forest = Forest(raw.plainForest)
+	forest.Projects = nil
+
+	legacy := []legacyProjectUpdate{}
+	for _, rawProject := range raw.Projects {
+		var probe struct {
+			Updates json.RawMessage `json:"updates"`
+		}
+		if err := json.Unmarshal(rawProject, &probe); err != nil {
+			return err
+		}
+
+		if probe.Updates != nil {
+			project := Project{}
+			if err := json.Unmarshal(rawProject, &project); err != nil {
+				return err
+			}
+			forest.Projects = append(forest.Projects, project)
+			continue
+		}
+
+		update := legacyProjectUpdate{}
+		if err := json.Unmarshal(rawProject, &update); err != nil {
+			return err
+		}
+		legacy = append(legacy, update)
+	}
+
+	// replay the snapshots edition by edition, oldest first,
+	// the same way they would have been crawled
+	sort.SliceStable(legacy, func(i, j int) bool {
+		return legacy[i].SopaReportDate < legacy[j].SopaReportDate
+	})
+	for start := 0; start < len(legacy); {
+		end := start
+		updates := []ProjectUpdate{}
+		for end < len(legacy) && legacy[end].SopaReportDate == legacy[start].SopaReportDate {
+			updates = append(updates, legacy[end].ProjectUpdate)
+			end++
+		}
+		for i, key := range forest.AddUpdates(updates) {
+			forest.Project(key).AddDocuments(legacy[start+i].ProjectDocuments)
+		}
+		start = end
+	}
+
+	return nil
+}
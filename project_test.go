@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// a forest saved when projects were a flat list of snapshots,
+// each carrying its own copy of the project's documents
+const legacyForestJson = `{
+	"name": "Sierra National Forest",
+	"state": "California",
+	"id": 110515,
+	"projects": [
+		{
+			"name": "Shaver Lake Fuels",
+			"id": "50001",
+			"status": "In Progress: Scoping Start 03/2021",
+			"sopa_report_date": "2021-07",
+			"project_documents": [{"url": "https://example.com/a.pdf", "name": "Scoping Letter"}]
+		},
+		{
+			"name": "Shaver Lake Fuels",
+			"id": "50001",
+			"status": "In Progress: Comment Period Public Notice 01/15/2022",
+			"sopa_report_date": "2022-01",
+			"project_documents": [
+				{"url": "https://example.com/a.pdf", "name": "Scoping Letter"},
+				{"url": "https://example.com/b.pdf", "name": "Draft EA"}
+			]
+		},
+		{
+			"name": "Dinkey Creek Trail",
+			"district": "High Sierra Ranger District",
+			"sopa_report_date": "2021-07"
+		}
+	]
+}`
+
+func TestForestUnmarshalLegacySnapshots(t *testing.T) {
+	forest := Forest{}
+	if err := json.Unmarshal([]byte(legacyForestJson), &forest); err != nil {
+		t.Fatal(err)
+	}
+
+	if forest.Name != "Sierra National Forest" || forest.Id != 110515 || forest.State.Code != "CA" {
+		t.Errorf("forest = %q %d %+v, want the legacy forest fields kept", forest.Name, forest.Id, forest.State)
+	}
+	if len(forest.Projects) != 2 {
+		t.Fatalf("got %d projects, want 2: %+v", len(forest.Projects), forest.Projects)
+	}
+
+	shaver := forest.Project("50001")
+	if shaver == nil {
+		t.Fatalf("no project keyed by its NEPA id: %+v", forest.Projects)
+	}
+	if len(shaver.Updates) != 2 || shaver.Updates[0].SopaReportDate != "2021-07" || shaver.Updates[1].SopaReportDate != "2022-01" {
+		t.Errorf("updates = %+v, want both editions oldest first", shaver.Updates)
+	}
+	if len(shaver.Documents) != 2 {
+		t.Errorf("documents = %+v, want the two distinct documents", shaver.Documents)
+	}
+	if status := shaver.Current().Status; status != "In Progress: Comment Period Public Notice 01/15/2022" {
+		t.Errorf("current status = %q, want the newest edition's", status)
+	}
+
+	for _, project := range forest.Projects {
+		if project.Key != "50001" && project.SyntheticId == "" {
+			t.Errorf("project without a NEPA id has no synthetic id: %+v", project)
+		}
+	}
+
+	// saved again in the current shape it loads the same
+	data, err := json.Marshal(forest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := Forest{}
+	if err := json.Unmarshal(data, &again); err != nil {
+		t.Fatal(err)
+	}
+	if same, err := sameJson(forest, again); err != nil {
+		t.Fatal(err)
+	} else if !same {
+		t.Errorf("round trip changed the forest:\n%s", data)
+	}
+}
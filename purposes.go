@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PurposeCode is one of the USFS project purpose codes from the SOPA legend
+type PurposeCode string
+
+// Purpose is a project purpose, with the label the SOPA legend gives its code
+type Purpose struct {
+	Code  PurposeCode `json:"code"`
+	Label string      `json:"label"`
+}
+
+var purposeLabels = map[PurposeCode]string{
+	"FC": "Facility management",
+	"FR": "Research",
+	"HF": "Fuels management",
+	"HR": "Heritage resource management",
+	"LM": "Land ownership management",
+	"LW": "Land acquisition",
+	"MG": "Minerals and geology",
+	"PN": "Land management planning",
+	"RD": "Road management",
+	"RG": "Grazing management",
+	"RO": "Regulations, directives, orders",
+	"RW": "Recreation management",
+	"SA": "Special area management",
+	"SU": "Special use management",
+	"TM": "Forest products",
+	"VM": "Vegetation management (other than forest products)",
+	"WF": "Wildlife, fish, rare plants",
+	"WM": "Water management",
+}
+
+var (
+	purposeCodeShape = regexp.MustCompile(`^[A-Z]{2}$`)
+	purposeSeparator = regexp.MustCompile(`(?:^|\s)-+(?:\s|$)|\n`)
+)
+
+// ParsePurposeCode understands a code, "HF", or its label, "Fuels management"
+func ParsePurposeCode(text string) (PurposeCode, error) {
+	text = trim(text)
+	for code, label := range purposeLabels {
+		if strings.EqualFold(text, string(code)) || strings.EqualFold(text, label) {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("unknown purpose code %q", text)
+}
+
+func (code PurposeCode) Label() string {
+	return purposeLabels[code]
+}
+
+// UnmarshalText lets --purpose take a code or a label, failing on others
+func (code *PurposeCode) UnmarshalText(text []byte) error {
+	parsed, err := ParsePurposeCode(string(text))
+	if err != nil {
+		return err
+	}
+	*code = parsed
+	return nil
+}
+
+// UnmarshalJSON also loads data sets saved when purposes were
+// plain strings, keeping ones we don't know as just a label
+func (purpose *Purpose) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		code, err := ParsePurposeCode(text)
+		if err != nil {
+			*purpose = Purpose{Label: text}
+		} else {
+			*purpose = Purpose{Code: code, Label: code.Label()}
+		}
+		return nil
+	}
+
+	type plainPurpose Purpose
+	return json.Unmarshal(data, (*plainPurpose)(purpose))
+}
+
+// parsePurposes reads the purpose cell, where each purpose is a code,
+// a label, or a code followed by its label, separated by dashes. It
+// returns the purposes, and the parts it couldn't match to a code.
+func parsePurposes(text string) ([]Purpose, []string) {
+	purposes := []Purpose{}
+	unknown := []string{}
+	have := map[PurposeCode]bool{}
+	for _, part := range purposeSeparator.Split(text, -1) {
+		part = trim(part)
+		if part == "" {
+			continue
+		}
+
+		code, err := ParsePurposeCode(part)
+		if err != nil {
+			unknown = append(unknown, part)
+			continue
+		}
+		// a code and its label are the same purpose
+		if !have[code] {
+			purposes = append(purposes, Purpose{Code: code, Label: code.Label()})
+			have[code] = true
+		}
+	}
+	return purposes, unknown
+}
+
+// HasPurpose is whether the snapshot lists any of the codes
+func (project ProjectUpdate) HasPurpose(codes []PurposeCode) bool {
+	for _, purpose := range project.Purposes {
+		for _, code := range codes {
+			if purpose.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PurposeCodes lists the snapshot's purpose codes, for exports
+func (project ProjectUpdate) PurposeCodes() string {
+	codes := []string{}
+	for _, purpose := range project.Purposes {
+		if purpose.Code != "" {
+			codes = append(codes, string(purpose.Code))
+		} else {
+			codes = append(codes, purpose.Label)
+		}
+	}
+	return strings.Join(codes, ", ")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePurposes(t *testing.T) {
+	tests := []struct {
+		text     string
+		purposes []Purpose
+		unknown  []string
+	}{
+		{"HF", []Purpose{{Code: "HF", Label: "Fuels management"}}, []string{}},
+		// a code and its label are one purpose
+		{"HF - Fuels management", []Purpose{{Code: "HF", Label: "Fuels management"}}, []string{}},
+		{"Wildlife, Fish, Rare plants", []Purpose{{Code: "WF", Label: "Wildlife, fish, rare plants"}}, []string{}},
+		{"HF - Fuels management - ZZ", []Purpose{{Code: "HF", Label: "Fuels management"}}, []string{"ZZ"}},
+		{"", []Purpose{}, []string{}},
+	}
+
+	for _, test := range tests {
+		purposes, unknown := parsePurposes(test.text)
+		if !reflect.DeepEqual(purposes, test.purposes) {
+			t.Errorf("parsePurposes(%q) = %+v, want %+v", test.text, purposes, test.purposes)
+		}
+		if !reflect.DeepEqual(unknown, test.unknown) {
+			t.Errorf("parsePurposes(%q) unknown = %q, want %q", test.text, unknown, test.unknown)
+		}
+	}
+}
+
+func TestSetPurposesUnknownCode(t *testing.T) {
+	project := ProjectUpdate{}
+	project.SetPurposes("HF - Fuels management - ZZ - Mystery")
+
+	want := []ParseIssue{
+		{Field: "purpose", Raw: "ZZ", Reason: "unknown purpose code"},
+		{Field: "purpose", Raw: "Mystery", Reason: "unknown purpose"},
+	}
+	if !reflect.DeepEqual(project.Issues, want) {
+		t.Errorf("issues = %+v, want %+v", project.Issues, want)
+	}
+	if !project.HasPurpose([]PurposeCode{"HF"}) {
+		t.Errorf("purposes = %+v, want HF kept", project.Purposes)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	log "github.com/sirupsen/logrus"
+)
+
+// s3Store keeps snapshots as objects in an S3 bucket, named
+// <prefix>YYYY-MM-DD.json, or another format's extension.
+// Anything else in the bucket is ignored.
+type s3Store struct {
+	service       *s3.S3
+	uploader      *s3manager.Uploader
+	bucket        string
+	prefix        string
+	latestPointer bool
+	format        string
+}
+
+// latestManifest is saved as <prefix>latest.json with --s3-latest-pointer
+type latestManifest struct {
+	Date    string    `json:"date"`
+	Key     string    `json:"key"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+func newS3Store(config StoreConfig) (*s3Store, error) {
+	if config.BucketName == "" {
+		return nil, errors.New("--bucket-name is required with --store=s3")
+	}
+
+	awsConfig := &aws.Config{
+		Region: aws.String(config.RegionId),
+	}
+	if config.AccessKeyId != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(
+			config.AccessKeyId,
+			config.SecretAccessKey,
+			"",
+		)
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Unable to setup AWS Session")
+		return nil, err
+	}
+
+	return &s3Store{
+		service:       s3.New(sess, &aws.Config{}),
+		uploader:      s3manager.NewUploader(sess),
+		bucket:        config.BucketName,
+		prefix:        config.S3Prefix,
+		latestPointer: config.S3LatestPointer,
+		format:        config.StoreFormat,
+	}, nil
+}
+
+func (store *s3Store) List(ctx context.Context) ([]string, error) {
+	return store.list(ctx, snapshotDate)
+}
+
+// list pages through every key under the prefix, returning what
+// name returns for each key it doesn't return "" for, sorted
+func (store *s3Store) list(ctx context.Context, name func(key string) string) ([]string, error) {
+	names := []string{}
+	err := store.service.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(store.bucket),
+		Prefix: aws.String(store.prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, content := range page.Contents {
+			if n := name(strings.TrimPrefix(*content.Key, store.prefix)); n != "" {
+				names = append(names, n)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return uniqueSorted(names), nil
+}
+
+// LoadLatest follows the latest.json manifest when there is one,
+// and lists the bucket otherwise
+func (store *s3Store) LoadLatest(ctx context.Context) (Dataset, string, error) {
+	if store.latestPointer {
+		manifest, err := store.loadManifest(ctx)
+		if err != nil {
+			return Dataset{}, "", err
+		}
+		if manifest != nil {
+			dataset, err := store.loadKey(ctx, manifest.Key)
+			return dataset, manifest.Date, err
+		}
+		log.WithFields(log.Fields{
+			"bucket": store.bucket,
+		}).Warn("No latest.json in bucket, listing snapshots")
+	}
+	return loadLatest(ctx, store)
+}
+
+func (store *s3Store) Load(ctx context.Context, date string) (Dataset, error) {
+	for _, name := range snapshotNames(date, store.format) {
+		dataset, err := store.loadKey(ctx, store.prefix+name)
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			continue
+		}
+		return dataset, err
+	}
+	return Dataset{}, fmt.Errorf("no data set snapshot for %s in bucket %s", date, store.bucket)
+}
+
+// loadKey streams the snapshot out of the bucket, decompressing it
+// by its extension or the content encoding it was uploaded with
+func (store *s3Store) loadKey(ctx context.Context, key string) (Dataset, error) {
+	getObjectOutput, err := store.service.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer getObjectOutput.Body.Close()
+
+	return readDataset(getObjectOutput.Body, key, aws.StringValue(getObjectOutput.ContentEncoding))
+}
+
+// Save streams the snapshot into the bucket as it's encoded
+func (store *s3Store) Save(ctx context.Context, date string, dataset Dataset) error {
+	name := snapshotName(date, store.format)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeDataset(pw, name, dataset))
+	}()
+
+	_, err := store.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Body:   pr,
+		Key:    aws.String(store.prefix + name),
+		Bucket: aws.String(store.bucket),
+	})
+	// stops the encoder if the upload gave up early
+	pr.CloseWithError(err)
+	if err != nil || !store.latestPointer {
+		return err
+	}
+
+	// never point back at an older snapshot
+	manifest, err := store.loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+	if manifest != nil && manifest.Date > date {
+		return nil
+	}
+	data, err := json.Marshal(latestManifest{
+		Date:    date,
+		Key:     store.prefix + name,
+		SavedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = store.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Body:   bytes.NewReader(data),
+		Key:    aws.String(store.prefix + "latest.json"),
+		Bucket: aws.String(store.bucket),
+	})
+	return err
+}
+
+// loadManifest returns nil when the bucket has no latest.json
+func (store *s3Store) loadManifest(ctx context.Context) (*latestManifest, error) {
+	getObjectOutput, err := store.service.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(store.prefix + "latest.json"),
+	})
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer getObjectOutput.Body.Close()
+
+	manifest := latestManifest{}
+	if err := json.NewDecoder(getObjectOutput.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("reading latest.json: %w", err)
+	}
+	if snapshotDate(snapshotName(manifest.Date, "")) == "" {
+		return nil, fmt.Errorf("latest.json points at %q, not a snapshot date", manifest.Date)
+	}
+	return &manifest, nil
+}
+
+func (store *s3Store) ListChangeSets(ctx context.Context) ([]string, error) {
+	return store.list(ctx, changeSetId)
+}
+
+func (store *s3Store) LoadChangeSet(ctx context.Context, id string) (ChangeSet, error) {
+	getObjectOutput, err := store.service.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(store.prefix + changeSetName(id)),
+	})
+	if err != nil {
+		return ChangeSet{}, err
+	}
+	defer getObjectOutput.Body.Close()
+
+	data, err := ioutil.ReadAll(getObjectOutput.Body)
+	if err != nil {
+		return ChangeSet{}, err
+	}
+	return decodeChangeSet(data)
+}
+
+func (store *s3Store) SaveChangeSet(ctx context.Context, changeSet ChangeSet) error {
+	data, err := json.Marshal(changeSet)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Body:   bytes.NewReader(data),
+		Key:    aws.String(store.prefix + changeSetName(changeSet.Id)),
+		Bucket: aws.String(store.bucket),
+	})
+	return err
+}
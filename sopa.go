@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
 	"time"
@@ -14,8 +14,12 @@ import (
 // GetSopaReportPages goes to the page that lists the SOPA reports
 // for a particular forest
 // https://www.fs.fed.us/sopa/forest-level.php?110801
-func GetSopaReportPages(url string) ([]string, error) {
-	res := get(url)
+func GetSopaReportPages(ctx context.Context, fetcher *Fetcher, url string) ([]string, error) {
+	res, err := fetcher.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
 
 	// Load the HTML document into goquery document
 	doc, err := goquery.NewDocumentFromReader(res.Body)
@@ -31,26 +35,46 @@ func GetSopaReportPages(url string) ([]string, error) {
 			if !exists {
 				val = ""
 			}
-			projectPages = append(projectPages, fmt.Sprintf("%s%s", baseUrl, val))
+			projectPages = append(projectPages, fetcher.Crawl.ReportUrl(val))
 		}
 	})
 
 	return projectPages, nil
 }
 
-func getProjects(url string) ([]ProjectUpdate, error) {
+// getProjects parses the projects on a SOPA report page. Problems
+// with a single project are attached to that project, problems with
+// the page itself are returned as the page's parse issues.
+func getProjects(ctx context.Context, fetcher *Fetcher, url string) ([]ProjectUpdate, []ParseIssue, error) {
 	// get nav page html
-	res := get(url)
+	res, err := fetcher.Get(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
 
 	// load the HTML document into goquery document
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var region []string // region and district
 	var project ProjectUpdate
+	pending := false // project has rows parsed but hasn't been added yet
 	projects := []ProjectUpdate{}
+	pageIssues := []ParseIssue{}
+	pageIssue := func(row int, field string, s *goquery.Selection, reason string) {
+		raw, _ := s.Html()
+		pageIssues = append(pageIssues, ParseIssue{
+			PageUrl: url,
+			Row:     row,
+			Field:   field,
+			Raw:     trim(raw),
+			Reason:  reason,
+		})
+	}
+
 	doc.Find("table tbody tr").Each(func(i int, s *goquery.Selection) {
 		if trim(s.Text()) == "No Projects matching your search criteria found..." {
 			return
@@ -70,11 +94,19 @@ func getProjects(url string) ([]ProjectUpdate, error) {
 					region = append(region, trim(s.Text()))
 				})
 			case "ProjectDescription":
+				if !pending {
+					pageIssue(i, "description", s, "description row without a project")
+					return
+				}
 				project.SetDescription(trim(s.Text()))
 			case "ProjectLocation":
-				project.Location = strings.Replace(trim(s.Text()), "Location:", "", 1)
-				project.Location = project.Location[1:] // remove first char, which isn't an ascii space
+				if !pending {
+					pageIssue(i, "location", s, "location row without a project")
+					return
+				}
+				project.SetLocation(trim(s.Text()))
 				projects = append(projects, project)
+				pending = false
 			}
 			return
 		}
@@ -83,23 +115,39 @@ func getProjects(url string) ([]ProjectUpdate, error) {
 			return
 		}
 
-		// if no region assume national
-		if region[1] == "" {
-			region[1] = "National"
+		// the last project never got a location row, keep what we have
+		if pending {
+			project.addIssue("location", "", "project has no location row")
+			projects = append(projects, project)
 		}
 
 		project = ProjectUpdate{
-			Region:   region[1],
-			District: region[0],
+			pageUrl: url,
+			row:     i,
+		}
+		pending = true
+
+		if len(region) < 2 {
+			raw, _ := s.Html()
+			project.addIssue("region", trim(raw), "project row is not in a group of projects")
+			if len(region) == 1 {
+				project.District = region[0]
+			}
+		} else {
+			project.District = region[0]
+			project.Region = region[1]
 		}
 
+		project.SetUsfsRegion(url)
+
 		// Set sopa report date on each project update
 		project.SetSopaReportDateFromURL(url)
 
 		s.Find("td").Each(func(i int, s *goquery.Selection) {
 			html, err := s.Html()
 			if err != nil {
-				log.Fatal(err.Error())
+				project.addIssue(projectColumn(i), s.Text(), err.Error())
+				return
 			}
 			html = trim(html) // TODO we're parsing the space in between projects, probably shouldn't
 			switch i {
@@ -110,25 +158,45 @@ func getProjects(url string) ([]ProjectUpdate, error) {
 			case 2:
 				project.SetStatus(html)
 			case 3:
-				project.Decision = trim(s.Text())
+				project.SetDecision(trim(s.Text()))
 			case 4:
-				project.ExpectedImplementation = trim(s.Text())
+				project.SetExpectedImplementation(trim(s.Text()))
 			case 5:
 				project.SetContacts(html)
 			}
 		})
 	})
-	return projects, nil
+
+	if pending {
+		project.addIssue("location", "", "project has no location row")
+		projects = append(projects, project)
+	}
+
+	return projects, pageIssues, nil
+}
+
+// projectColumns names the cells of a project row, for parse issues
+var projectColumns = []string{"name", "purpose", "status", "decision", "expected_implementation", "contact"}
+
+// projectColumn is the name of cell i, cells past the known ones are "column N"
+func projectColumn(i int) string {
+	if i < len(projectColumns) {
+		return projectColumns[i]
+	}
+	return fmt.Sprintf("column %d", i+1)
 }
 
 var getDate = regexp.MustCompile(`(\d\d-\d\d-\d\d\d\d)`)
 
-func getReportDocumentMeta(id string) ([]ProjectDocument, error) {
+func getReportDocumentMeta(ctx context.Context, fetcher *Fetcher, id string) ([]ProjectDocument, error) {
+	res, err := fetcher.Get(ctx, fetcher.Crawl.ProjectDocumentsUrl(id))
+	if err != nil {
+		return []ProjectDocument{}, err
+	}
+	defer res.Body.Close()
+
 	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(fmt.Sprintf(
-		"https://www.fs.usda.gov/wps/PA_Nepa/neparssgetfile?project=%s",
-		id,
-	))
+	feed, err := fp.Parse(res.Body)
 	if err != nil {
 		return []ProjectDocument{}, err
 	}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+type SqliteConfig struct {
+	Sqlite string `help:"Also write forests to this SQLite database as each one is crawled or updated" type:"path" placeholder:"FILE"`
+}
+
+// OpenSqlite returns nil when no database was asked for
+func (config SqliteConfig) OpenSqlite(ctx context.Context) (*sqliteDb, error) {
+	if config.Sqlite == "" {
+		return nil, nil
+	}
+	return openSqlite(ctx, config.Sqlite)
+}
+
+// sqliteMigrations are applied in order, each one once. Only ever add to the end.
+var sqliteMigrations = []string{
+	`CREATE TABLE forests (
+		id         INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		state_code TEXT NOT NULL,
+		state_name TEXT NOT NULL,
+		region     TEXT NOT NULL,
+		url        TEXT NOT NULL
+	);
+	CREATE TABLE projects (
+		forest_id    INTEGER NOT NULL,
+		key          TEXT NOT NULL,
+		nepa_id      TEXT NOT NULL,
+		synthetic_id TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		PRIMARY KEY (forest_id, key)
+	);
+	CREATE TABLE updates (
+		forest_id                INTEGER NOT NULL,
+		project_key              TEXT NOT NULL,
+		sopa_report_date         TEXT NOT NULL,
+		name                     TEXT NOT NULL,
+		project_code             TEXT NOT NULL,
+		status                   TEXT NOT NULL,
+		stage                    TEXT NOT NULL,
+		decision                 TEXT NOT NULL,
+		analysis_type            TEXT NOT NULL,
+		objection_eligible       INTEGER,
+		expected_implementation  TEXT NOT NULL,
+		implementation_earliest  TEXT,
+		implementation_latest    TEXT,
+		implementation_precision TEXT NOT NULL,
+		description              TEXT NOT NULL,
+		web_link                 TEXT NOT NULL,
+		location                 TEXT NOT NULL,
+		region                   TEXT NOT NULL,
+		usfs_region              TEXT NOT NULL,
+		district                 TEXT NOT NULL,
+		match_confidence         REAL NOT NULL,
+		PRIMARY KEY (forest_id, project_key, sopa_report_date)
+	);
+	CREATE TABLE update_purposes (
+		forest_id        INTEGER NOT NULL,
+		project_key      TEXT NOT NULL,
+		sopa_report_date TEXT NOT NULL,
+		code             TEXT NOT NULL,
+		label            TEXT NOT NULL
+	);
+	CREATE INDEX update_purposes_code ON update_purposes (code);
+	CREATE TABLE contacts (
+		forest_id        INTEGER NOT NULL,
+		project_key      TEXT NOT NULL,
+		sopa_report_date TEXT NOT NULL,
+		position         INTEGER NOT NULL,
+		name             TEXT NOT NULL,
+		email            TEXT NOT NULL,
+		phone            TEXT NOT NULL,
+		phone_e164       TEXT NOT NULL,
+		extension        TEXT NOT NULL,
+		PRIMARY KEY (forest_id, project_key, sopa_report_date, position)
+	);
+	CREATE TABLE documents (
+		forest_id   INTEGER NOT NULL,
+		project_key TEXT NOT NULL,
+		url         TEXT NOT NULL,
+		name        TEXT NOT NULL,
+		category    TEXT NOT NULL,
+		date_string TEXT NOT NULL,
+		date        TEXT,
+		PRIMARY KEY (forest_id, project_key, url)
+	);`,
+}
+
+// sqliteDb is the forests as tables, for analysis. Forests are written
+// whole, replacing what was there, so it can be written to as a crawl
+// finishes each forest.
+type sqliteDb struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+func openSqlite(ctx context.Context, path string) (*sqliteDb, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteDb{db: db}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteDb) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteDb) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d: %w", version+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveForest replaces everything stored for the forest. Forests are
+// keyed on their id, so one without an id is skipped rather than
+// mixed in with every other forest missing one.
+func (s *sqliteDb) SaveForest(ctx context.Context, forest Forest) error {
+	if forest.Id == 0 {
+		log.WithFields(log.Fields{
+			"forest": forest.Name,
+			"state":  forest.State,
+		}).Warn("Forest has no id, not writing it to sqlite")
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := saveForestTx(ctx, tx, forest); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("saving forest %q to sqlite: %w", forest.Name, err)
+	}
+	return tx.Commit()
+}
+
+func saveForestTx(ctx context.Context, tx *sql.Tx, forest Forest) error {
+	for _, table := range []string{"projects", "updates", "update_purposes", "contacts", "documents"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE forest_id = ?`, forest.Id); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO forests (id, name, state_code, state_name, region, url) VALUES (?, ?, ?, ?, ?, ?)`,
+		forest.Id, forest.Name, forest.State.Code, forest.State.Name, string(forest.Region), forest.Url,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range forest.Projects {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO projects (forest_id, key, nepa_id, synthetic_id, name) VALUES (?, ?, ?, ?, ?)`,
+			forest.Id, project.Key, project.Id, project.SyntheticId, project.Name,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, update := range project.Updates {
+			if err := saveUpdateTx(ctx, tx, forest.Id, project.Key, update); err != nil {
+				return err
+			}
+		}
+
+		for _, doc := range project.Documents {
+			_, err := tx.ExecContext(ctx,
+				`INSERT OR REPLACE INTO documents (forest_id, project_key, url, name, category, date_string, date) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				forest.Id, project.Key, doc.Url, doc.Name, doc.Category, doc.DateString, nullDate(formatDate(doc.Date)),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func saveUpdateTx(ctx context.Context, tx *sql.Tx, forestId int, projectKey string, update ProjectUpdate) error {
+	var objectionEligible interface{}
+	if update.ObjectionEligible != nil {
+		objectionEligible = *update.ObjectionEligible
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO updates (
+			forest_id, project_key, sopa_report_date, name, project_code,
+			status, stage, decision, analysis_type, objection_eligible,
+			expected_implementation, implementation_earliest, implementation_latest, implementation_precision,
+			description, web_link, location, region, usfs_region, district, match_confidence
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		forestId, projectKey, update.SopaReportDate, update.Name, update.ProjectCode,
+		update.Status, string(update.Stage), update.Decision, string(update.AnalysisType), objectionEligible,
+		update.ExpectedImplementation,
+		nullDate(formatDate(update.ImplementationWindow.Earliest)),
+		nullDate(formatDate(update.ImplementationWindow.Latest)),
+		string(update.ImplementationWindow.Precision),
+		update.Description, update.WebLink, update.Location, update.Region, string(update.UsfsRegion), update.District,
+		update.MatchConfidence,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, purpose := range update.Purposes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO update_purposes (forest_id, project_key, sopa_report_date, code, label) VALUES (?, ?, ?, ?, ?)`,
+			forestId, projectKey, update.SopaReportDate, string(purpose.Code), purpose.Label,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, contact := range update.Contacts {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO contacts (forest_id, project_key, sopa_report_date, position, name, email, phone, phone_e164, extension) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			forestId, projectKey, update.SopaReportDate, i, contact.Name, contact.Email, contact.Phone, contact.PhoneE164, contact.Extension,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullDate stores unknown dates as NULL
+func nullDate(date string) interface{} {
+	if strings.TrimSpace(date) == "" {
+		return nil
+	}
+	return date
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ProjectStage is where a project is in the NEPA process,
+// parsed out of the SOPA status column
+type ProjectStage string
+
+const (
+	StageUnknown            ProjectStage = ""
+	StageDevelopingProposal ProjectStage = "developing_proposal"
+	StageScoping            ProjectStage = "scoping"
+	StageAnalysis           ProjectStage = "analysis"
+	StageDecision           ProjectStage = "decision"
+	StageObjection          ProjectStage = "objection"
+	StageCompleted          ProjectStage = "completed"
+	StageOnHold             ProjectStage = "on_hold"
+	StageCancelled          ProjectStage = "cancelled"
+)
+
+// Milestone is a dated step listed in the status column, like
+// "Scoping Start 03/2021" or "Est. Decision Signed 06/2022"
+type Milestone struct {
+	Name       string    `json:"name"`
+	DateString string    `json:"date_string"`
+	Date       time.Time `json:"date"`
+	Estimated  bool      `json:"estimated"`
+}
+
+var milestonePattern = regexp.MustCompile(`(?i)(est\.?\s+)?([a-z][a-z .'/-]*?)\s*:?\s*(\d{1,2}/(?:\d{1,2}/)?\d{4})`)
+
+// milestoneStages maps words in a milestone name to the stage the
+// project is in once that milestone has actually happened, most
+// advanced stage first
+var milestoneStages = []struct {
+	word  string
+	stage ProjectStage
+}{
+	{"objection", StageObjection},
+	{"decision", StageDecision},
+	{"comment", StageAnalysis},
+	{"analysis", StageAnalysis},
+	{"notice of intent", StageAnalysis},
+	{"noi", StageAnalysis},
+	{"draft", StageAnalysis},
+	{"scoping", StageScoping},
+}
+
+// stageRank orders stages through the process, for picking
+// the furthest milestone a project has reached
+var stageRank = map[ProjectStage]int{
+	StageDevelopingProposal: 1,
+	StageScoping:            2,
+	StageAnalysis:           3,
+	StageDecision:           4,
+	StageObjection:          5,
+}
+
+// parseMilestones pulls every dated milestone out of the status text
+func parseMilestones(status string) []Milestone {
+	milestones := []Milestone{}
+	for _, line := range strings.Split(status, "\n") {
+		for _, matches := range milestonePattern.FindAllStringSubmatch(line, -1) {
+			milestone := Milestone{
+				Name:       trim(matches[2]),
+				DateString: matches[3],
+				Estimated:  matches[1] != "",
+			}
+			for _, layout := range []string{"01/02/2006", "1/2/2006", "01/2006", "1/2006"} {
+				if date, err := time.Parse(layout, milestone.DateString); err == nil {
+					milestone.Date = date
+					break
+				}
+			}
+			milestones = append(milestones, milestone)
+		}
+	}
+	return milestones
+}
+
+// parseStage reads the stage from the status text. Closed out projects
+// say so up front, projects in progress are at the furthest milestone
+// that has actually happened.
+func parseStage(status string, milestones []Milestone) ProjectStage {
+	lower := strings.ToLower(status)
+	switch {
+	case strings.Contains(lower, "cancel"):
+		return StageCancelled
+	case strings.Contains(lower, "on hold"):
+		return StageOnHold
+	case strings.HasPrefix(lower, "completed"):
+		return StageCompleted
+	}
+
+	stage := StageUnknown
+	if strings.Contains(lower, "developing proposal") {
+		stage = StageDevelopingProposal
+	}
+	for _, milestone := range milestones {
+		if milestone.Estimated {
+			continue
+		}
+		name := strings.ToLower(milestone.Name)
+		for _, ms := range milestoneStages {
+			if strings.Contains(name, ms.word) {
+				if stageRank[ms.stage] > stageRank[stage] {
+					stage = ms.stage
+				}
+				break
+			}
+		}
+	}
+
+	// nothing has actually happened yet, so the project is in
+	// the stage before its first estimated milestone
+	if stage == StageUnknown {
+		for _, milestone := range milestones {
+			name := strings.ToLower(milestone.Name)
+			for _, ms := range milestoneStages {
+				if strings.Contains(name, ms.word) {
+					if before := previousStage(ms.stage); stage == StageUnknown || stageRank[before] < stageRank[stage] {
+						stage = before
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return stage
+}
+
+func previousStage(stage ProjectStage) ProjectStage {
+	for previous, rank := range stageRank {
+		if rank == stageRank[stage]-1 {
+			return previous
+		}
+	}
+	return StageDevelopingProposal
+}
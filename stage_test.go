@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStage(t *testing.T) {
+	tests := []struct {
+		status     string
+		stage      ProjectStage
+		milestones []Milestone
+	}{
+		{
+			status: "In Progress: Scoping Start 03/2021",
+			stage:  StageScoping,
+			milestones: []Milestone{
+				{Name: "Scoping Start", DateString: "03/2021", Date: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			status: "Completed: Decision Signed 06/2021",
+			stage:  StageCompleted,
+			milestones: []Milestone{
+				{Name: "Decision Signed", DateString: "06/2021", Date: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			// estimated milestones haven't happened yet
+			status: "In Progress:\nScoping Start 03/2021\nEst. Decision Signed 06/2022",
+			stage:  StageScoping,
+			milestones: []Milestone{
+				{Name: "Scoping Start", DateString: "03/2021", Date: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+				{Name: "Decision Signed", DateString: "06/2022", Date: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC), Estimated: true},
+			},
+		},
+		{
+			status: "In Progress: Comment Period Public Notice 01/15/2022",
+			stage:  StageAnalysis,
+			milestones: []Milestone{
+				{Name: "Comment Period Public Notice", DateString: "01/15/2022", Date: time.Date(2022, 1, 15, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			status: "Developing Proposal: Est. Scoping Start 05/2023",
+			stage:  StageDevelopingProposal,
+			milestones: []Milestone{
+				{Name: "Scoping Start", DateString: "05/2023", Date: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), Estimated: true},
+			},
+		},
+		{status: "On Hold", stage: StageOnHold, milestones: []Milestone{}},
+		{status: "Cancelled", stage: StageCancelled, milestones: []Milestone{}},
+		{status: "", stage: StageUnknown, milestones: []Milestone{}},
+	}
+
+	for _, test := range tests {
+		milestones := parseMilestones(test.status)
+		if len(milestones) != len(test.milestones) {
+			t.Errorf("parseMilestones(%q) = %+v, want %+v", test.status, milestones, test.milestones)
+		} else {
+			for i := range milestones {
+				if milestones[i] != test.milestones[i] {
+					t.Errorf("parseMilestones(%q)[%d] = %+v, want %+v", test.status, i, milestones[i], test.milestones[i])
+				}
+			}
+		}
+
+		if stage := parseStage(test.status, milestones); stage != test.stage {
+			t.Errorf("parseStage(%q) = %q, want %q", test.status, stage, test.stage)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// State is a US state or territory. It's written to JSON
+// as its USPS code, e.g. "CA".
+type State struct {
+	Code string // USPS code
+	Name string
+	Fips string
+}
+
+var states = []State{
+	{"AL", "Alabama", "01"},
+	{"AK", "Alaska", "02"},
+	{"AZ", "Arizona", "04"},
+	{"AR", "Arkansas", "05"},
+	{"CA", "California", "06"},
+	{"CO", "Colorado", "08"},
+	{"CT", "Connecticut", "09"},
+	{"DE", "Delaware", "10"},
+	{"DC", "District of Columbia", "11"},
+	{"FL", "Florida", "12"},
+	{"GA", "Georgia", "13"},
+	{"HI", "Hawaii", "15"},
+	{"ID", "Idaho", "16"},
+	{"IL", "Illinois", "17"},
+	{"IN", "Indiana", "18"},
+	{"IA", "Iowa", "19"},
+	{"KS", "Kansas", "20"},
+	{"KY", "Kentucky", "21"},
+	{"LA", "Louisiana", "22"},
+	{"ME", "Maine", "23"},
+	{"MD", "Maryland", "24"},
+	{"MA", "Massachusetts", "25"},
+	{"MI", "Michigan", "26"},
+	{"MN", "Minnesota", "27"},
+	{"MS", "Mississippi", "28"},
+	{"MO", "Missouri", "29"},
+	{"MT", "Montana", "30"},
+	{"NE", "Nebraska", "31"},
+	{"NV", "Nevada", "32"},
+	{"NH", "New Hampshire", "33"},
+	{"NJ", "New Jersey", "34"},
+	{"NM", "New Mexico", "35"},
+	{"NY", "New York", "36"},
+	{"NC", "North Carolina", "37"},
+	{"ND", "North Dakota", "38"},
+	{"OH", "Ohio", "39"},
+	{"OK", "Oklahoma", "40"},
+	{"OR", "Oregon", "41"},
+	{"PA", "Pennsylvania", "42"},
+	{"RI", "Rhode Island", "44"},
+	{"SC", "South Carolina", "45"},
+	{"SD", "South Dakota", "46"},
+	{"TN", "Tennessee", "47"},
+	{"TX", "Texas", "48"},
+	{"UT", "Utah", "49"},
+	{"VT", "Vermont", "50"},
+	{"VA", "Virginia", "51"},
+	{"WA", "Washington", "53"},
+	{"WV", "West Virginia", "54"},
+	{"WI", "Wisconsin", "55"},
+	{"WY", "Wyoming", "56"},
+	{"AS", "American Samoa", "60"},
+	{"GU", "Guam", "66"},
+	{"MP", "Northern Mariana Islands", "69"},
+	{"PR", "Puerto Rico", "72"},
+	{"VI", "Virgin Islands", "78"},
+}
+
+// ParseState takes a USPS code or a full name, in any case
+func ParseState(text string) (State, error) {
+	text = trim(text)
+	for _, state := range states {
+		if strings.EqualFold(text, state.Code) || strings.EqualFold(text, state.Name) {
+			return state, nil
+		}
+	}
+	return State{}, fmt.Errorf("unknown state %q", text)
+}
+
+func (state State) String() string {
+	return state.Name
+}
+
+func (state State) IsZero() bool {
+	return state.Code == "" && state.Name == ""
+}
+
+func (state State) MarshalText() ([]byte, error) {
+	if state.Code == "" {
+		// never validated, keep whatever we were given
+		return []byte(state.Name), nil
+	}
+	return []byte(state.Code), nil
+}
+
+// UnmarshalText is strict, it's used for command line flags like
+// --state where a typo shouldn't quietly match nothing
+func (state *State) UnmarshalText(text []byte) error {
+	parsed, err := ParseState(string(text))
+	if err != nil {
+		return err
+	}
+	*state = parsed
+	return nil
+}
+
+// UnmarshalJSON keeps unknown states as their name, so data sets
+// saved before states were typed still load
+func (state *State) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	parsed, err := ParseState(text)
+	if err != nil {
+		parsed = State{Name: text}
+	}
+	*state = parsed
+	return nil
+}
+
+// USFSRegion is a Forest Service region, "R1" through "R10", or
+// "National" for projects that aren't tied to a region. There
+// is no R7, it was split between R8 and R9 in 1966.
+type USFSRegion string
+
+const (
+	RegionNational USFSRegion = "National"
+	RegionUnknown  USFSRegion = ""
+)
+
+var usfsRegionNames = map[USFSRegion]string{
+	"R1":           "Northern",
+	"R2":           "Rocky Mountain",
+	"R3":           "Southwestern",
+	"R4":           "Intermountain",
+	"R5":           "Pacific Southwest",
+	"R6":           "Pacific Northwest",
+	"R8":           "Southern",
+	"R9":           "Eastern",
+	"R10":          "Alaska",
+	RegionNational: "National",
+}
+
+var usfsRegionNumber = regexp.MustCompile(`^(?:r|region)?\s*0?(\d{1,2})$`)
+
+// ParseUSFSRegion understands "R5", "Region 05", "5",
+// "Pacific Southwest" and "Pacific Southwest Region"
+func ParseUSFSRegion(text string) (USFSRegion, error) {
+	normalized := strings.ToLower(trim(text))
+	switch normalized {
+	case "national", "nationwide", "washington office", "wo":
+		return RegionNational, nil
+	}
+
+	if matches := usfsRegionNumber.FindStringSubmatch(normalized); len(matches) == 2 {
+		region := USFSRegion("R" + strings.TrimLeft(matches[1], "0"))
+		if _, ok := usfsRegionNames[region]; ok {
+			return region, nil
+		}
+	}
+
+	normalized = strings.TrimSuffix(normalized, " region")
+	for region, name := range usfsRegionNames {
+		if normalized == strings.ToLower(name) {
+			return region, nil
+		}
+	}
+
+	return RegionUnknown, fmt.Errorf("unknown USFS region %q", text)
+}
+
+// regionFromForestId reads the region out of a SOPA forest id,
+// which is 11 for the Forest Service, then the region and forest
+// numbers, e.g. 110519 is forest 19 in R5
+func regionFromForestId(id int) USFSRegion {
+	if id < 110000 || id > 119999 {
+		return RegionUnknown
+	}
+	region := USFSRegion("R" + strconv.Itoa((id/100)%100))
+	if _, ok := usfsRegionNames[region]; !ok {
+		return RegionUnknown
+	}
+	return region
+}
+
+func (region USFSRegion) Name() string {
+	return usfsRegionNames[region]
+}
+
+// UnmarshalText fails on a --region ParseUSFSRegion can't make sense
+// of, rather than leaving it unknown like UnmarshalJSON
+func (region *USFSRegion) UnmarshalText(text []byte) error {
+	parsed, err := ParseUSFSRegion(string(text))
+	if err != nil {
+		return err
+	}
+	*region = parsed
+	return nil
+}
+
+// UnmarshalJSON leaves regions it doesn't know as unknown
+func (region *USFSRegion) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*region, _ = ParseUSFSRegion(text)
+	return nil
+}
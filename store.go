@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Store keeps dated snapshots of the data set, one per day. Loads hold
+// the whole data set in memory, since change sets are applied to all of
+// it. Only data set files, with readDatasetFile, are read a forest at a
+// time.
+type Store interface {
+	// List returns the dates of every snapshot, oldest first
+	List(ctx context.Context) ([]string, error)
+	// LoadLatest returns ErrNoSnapshots when the store is empty
+	LoadLatest(ctx context.Context) (Dataset, string, error)
+	Load(ctx context.Context, date string) (Dataset, error)
+	// Save replaces any snapshot already saved for the date
+	Save(ctx context.Context, date string, dataset Dataset) error
+
+	// ListChangeSets returns the ids of every change set, oldest first
+	ListChangeSets(ctx context.Context) ([]string, error)
+	LoadChangeSet(ctx context.Context, id string) (ChangeSet, error)
+	SaveChangeSet(ctx context.Context, changeSet ChangeSet) error
+}
+
+// ErrNoSnapshots is returned when loading the latest snapshot of an empty store
+var ErrNoSnapshots = errors.New("no data set snapshots in store")
+
+const (
+	storeS3     = "s3"
+	storeDir    = "dir"
+	storeMemory = "memory"
+)
+
+// StoreConfig picks where data sets are loaded from and saved to
+type StoreConfig struct {
+	Store           string `help:"Where data sets are kept, one of s3, dir or memory. Defaults to s3 for parse-updates and dir otherwise" enum:",s3,dir,memory" default:""`
+	StoreDir        string `help:"Directory data sets are kept in with --store=dir" type:"path" default:"data"`
+	AccessKeyId     string `env help:"AWS Access Key ID, the default credential chain is used when empty" type:"string"`
+	SecretAccessKey string `env help:"AWS Secret Access Key" type:"string"`
+	RegionId        string `env help:"AWS Region ID" type:"string"`
+	BucketName      string `help:"S3 bucket data sets are kept in with --store=s3" type:"string"`
+	S3Prefix        string `name:"s3-prefix" help:"Key prefix data set snapshots are kept under in the bucket, e.g. snapshots/" type:"string"`
+	S3LatestPointer bool   `name:"s3-latest-pointer" help:"Keep a latest.json manifest next to the snapshots pointing at the newest one, and read it instead of listing the bucket"`
+	StoreFormat     string `help:"Format new snapshots are saved in, snapshots in any format are read" enum:"json,json.gz,json.zst,ndjson,ndjson.gz,ndjson.zst" default:"json"`
+}
+
+// OpenStore opens the configured store, or backend when none was picked
+func (config StoreConfig) OpenStore(backend string) (Store, error) {
+	if config.Store != "" {
+		backend = config.Store
+	}
+	switch backend {
+	case storeS3:
+		return newS3Store(config)
+	case storeDir:
+		return newDirStore(config.StoreDir, config.StoreFormat)
+	case storeMemory:
+		return newMemoryStore(config.StoreFormat), nil
+	}
+	return nil, fmt.Errorf("unknown store %q", backend)
+}
+
+var snapshotPattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\.(?:nd)?json(?:\.gz|\.zst)?$`)
+
+var snapshotFormats = []string{"json", "json.gz", "json.zst", "ndjson", "ndjson.gz", "ndjson.zst"}
+
+// snapshotName is the file or key a snapshot is saved under, e.g. 2022-06-01.ndjson.gz
+func snapshotName(date string, format string) string {
+	if format == "" {
+		format = "json"
+	}
+	return date + "." + format
+}
+
+// snapshotNames is every name a snapshot from the date could
+// be saved under, the one for format first
+func snapshotNames(date string, format string) []string {
+	names := []string{snapshotName(date, format)}
+	for _, other := range snapshotFormats {
+		if name := snapshotName(date, other); name != names[0] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// uniqueSorted sorts the names, dropping repeats, which
+// are snapshots from the same date in different formats
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+	unique := []string{}
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// snapshotDate is the date of the snapshot saved as name,
+// or "" when name isn't a snapshot
+func snapshotDate(name string) string {
+	matches := snapshotPattern.FindStringSubmatch(name)
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// loadLatest is LoadLatest for stores that can list their snapshots
+func loadLatest(ctx context.Context, store Store) (Dataset, string, error) {
+	dates, err := store.List(ctx)
+	if err != nil {
+		return Dataset{}, "", err
+	}
+	if len(dates) == 0 {
+		return Dataset{}, "", ErrNoSnapshots
+	}
+	date := dates[len(dates)-1]
+	dataset, err := store.Load(ctx, date)
+	return dataset, date, err
+}
+
+// memoryStore keeps snapshots encoded, the same as the other stores, for tests
+type memoryStore struct {
+	mu         sync.Mutex
+	format     string
+	snapshots  map[string]memorySnapshot
+	changeSets map[string][]byte
+}
+
+type memorySnapshot struct {
+	name string
+	data []byte
+}
+
+func newMemoryStore(format string) *memoryStore {
+	return &memoryStore{
+		format:     format,
+		snapshots:  map[string]memorySnapshot{},
+		changeSets: map[string][]byte{},
+	}
+}
+
+func (store *memoryStore) List(ctx context.Context) ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	dates := []string{}
+	for date := range store.snapshots {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+func (store *memoryStore) LoadLatest(ctx context.Context) (Dataset, string, error) {
+	return loadLatest(ctx, store)
+}
+
+func (store *memoryStore) Load(ctx context.Context, date string) (Dataset, error) {
+	store.mu.Lock()
+	snapshot, ok := store.snapshots[date]
+	store.mu.Unlock()
+	if !ok {
+		return Dataset{}, fmt.Errorf("no data set snapshot for %s", date)
+	}
+	return readDataset(bytes.NewReader(snapshot.data), snapshot.name, "")
+}
+
+func (store *memoryStore) Save(ctx context.Context, date string, dataset Dataset) error {
+	name := snapshotName(date, store.format)
+	data, err := encodeDataset(name, dataset)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.snapshots[date] = memorySnapshot{name: name, data: data}
+	return nil
+}
+
+func (store *memoryStore) ListChangeSets(ctx context.Context) ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	ids := []string{}
+	for id := range store.changeSets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (store *memoryStore) LoadChangeSet(ctx context.Context, id string) (ChangeSet, error) {
+	store.mu.Lock()
+	data, ok := store.changeSets[id]
+	store.mu.Unlock()
+	if !ok {
+		return ChangeSet{}, fmt.Errorf("no change set %s", id)
+	}
+	return decodeChangeSet(data)
+}
+
+func (store *memoryStore) SaveChangeSet(ctx context.Context, changeSet ChangeSet) error {
+	data, err := json.Marshal(changeSet)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.changeSets[changeSet.Id] = data
+	return nil
+}
@@ -2,44 +2,43 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/nyaruka/phonenumbers"
+	"unicode"
 )
 
-var baseUrl = "https://www.fs.fed.us"
-
 type Forest struct {
-	Name        string          `json:"name"`
-	State       string          `json:"state"`
-	Url         string          `json:"url"`
-	Id          int             `json:"id"`
-	Projects    []ProjectUpdate `json:"projects"`
-	SopaReports []string        `json:"sopa_reports"`
+	Name        string       `json:"name"`
+	State       State        `json:"state"`
+	Region      USFSRegion   `json:"region"`
+	Url         string       `json:"url"`
+	Id          int          `json:"id"`
+	Projects    []Project    `json:"projects"`
+	SopaReports []string     `json:"sopa_reports"`
+	ParseIssues []ParseIssue `json:"parse_issues,omitempty"`
 }
 
 func (forest Forest) AsCsv() [][]string {
 	rows := [][]string{}
 	baseRow := []string{
 		forest.Name,
-		forest.State,
+		forest.State.Name,
 		forest.Url,
 		fmt.Sprint(forest.Id),
 	}
-	for _, project := range forest.Projects {
+	for _, project := range forest.Updates() {
 		rows = append(rows, append(baseRow, []string{
 			project.Name,
 			project.Id,
-			strings.Join(project.Purposes, ", "),
+			project.PurposeCodes(),
 			project.Status,
 			project.Decision,
 			project.ExpectedImplementation,
-			project.Contact.Name,
-			project.Contact.Email,
-			project.Contact.Phone,
+			project.PrimaryContact().Name,
+			project.PrimaryContact().Email,
+			project.PrimaryContact().Phone,
 			project.Description,
 			project.WebLink,
 			project.Location,
@@ -47,27 +46,44 @@ func (forest Forest) AsCsv() [][]string {
 			project.District,
 			project.SopaReportDate,
 			project.ProjectCode,
+			string(project.Stage),
+			string(project.AnalysisType),
+			formatDate(project.ImplementationWindow.Earliest),
+			formatDate(project.ImplementationWindow.Latest),
+			string(project.ImplementationWindow.Precision),
 		}...))
 	}
 	return rows
 }
 
 type ProjectUpdate struct {
-	Name                   string            `json:"name"`
-	Id                     string            `json:"id"`
-	Purposes               []string          `json:"purpose"`
-	Status                 string            `json:"status"`
-	Decision               string            `json:"decision"`
-	ExpectedImplementation string            `json:"expected_implementation"`
-	Contact                Contact           `json:"contact"`
-	Description            string            `json:"description"`
-	WebLink                string            `json:"web_link"`
-	Location               string            `json:"location"`
-	Region                 string            `json:"region"`
-	District               string            `json:"district"`
-	SopaReportDate         string            `json:"sopa_report_date"`
-	ProjectCode            string            `json:"project_code"`
-	ProjectDocuments       []ProjectDocument `json:"project_documents"`
+	Name                   string               `json:"name"`
+	Id                     string               `json:"id"`
+	Purposes               []Purpose            `json:"purpose"`
+	Status                 string               `json:"status"`
+	Stage                  ProjectStage         `json:"stage"`
+	Milestones             []Milestone          `json:"milestones"`
+	Decision               string               `json:"decision"`
+	AnalysisType           AnalysisType         `json:"analysis_type"`
+	ObjectionEligible      *bool                `json:"objection_eligible,omitempty"`
+	ExpectedImplementation string               `json:"expected_implementation"`
+	ImplementationWindow   ImplementationWindow `json:"expected_implementation_window"`
+	Contacts               []Contact            `json:"contacts"`
+	Description            string               `json:"description"`
+	WebLink                string               `json:"web_link"`
+	Location               string               `json:"location"`
+	LocationDetail         Location             `json:"location_detail"`
+	Region                 string               `json:"region"`
+	UsfsRegion             USFSRegion           `json:"usfs_region"`
+	District               string               `json:"district"`
+	SopaReportDate         string               `json:"sopa_report_date"`
+	ProjectCode            string               `json:"project_code"`
+	Issues                 []ParseIssue         `json:"issues,omitempty"`
+	MatchConfidence        float64              `json:"match_confidence,omitempty"`
+
+	// where the project was parsed from, for parse issues
+	pageUrl string
+	row     int
 }
 
 type ProjectDocument struct {
@@ -78,10 +94,14 @@ type ProjectDocument struct {
 	Url        string    `json:"url"`
 }
 
+// Contact is one person listed for a project. Phone is nationally
+// formatted, or as listed when it isn't a valid number.
 type Contact struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Phone string `json:"phone"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	PhoneE164 string `json:"phone_e164,omitempty"`
+	Extension string `json:"extension,omitempty"`
 }
 
 func (project *ProjectUpdate) SetNameAndCode(html string) {
@@ -92,33 +112,78 @@ func (project *ProjectUpdate) SetNameAndCode(html string) {
 	}
 }
 
+// SetPurposes matches the purpose cell against the USFS purpose codes
 func (project *ProjectUpdate) SetPurposes(text string) {
-	purposes := strings.Split(text, " - ")
-	for i, purpose := range purposes {
-		purpose = strings.Trim(purpose, "-")
-		purpose = strings.TrimSpace(purpose)
-		purposes[i] = purpose
-	}
+	purposes, unknown := parsePurposes(text)
 	project.Purposes = purposes
+	for _, part := range unknown {
+		reason := "unknown purpose"
+		if purposeCodeShape.MatchString(part) {
+			reason = "unknown purpose code"
+		}
+		project.addIssue("purpose", part, reason)
+	}
 }
 
+// SetStatus keeps the raw status text and parses the stage and milestones out of it
 func (project *ProjectUpdate) SetStatus(html string) {
 	project.Status = strings.ReplaceAll(html, "<br/>", "\n")
+	project.Milestones = parseMilestones(project.Status)
+	project.Stage = parseStage(project.Status, project.Milestones)
+	if project.Stage == StageUnknown {
+		project.addIssue("status", html, "unable to tell the project's stage")
+	}
+}
+
+// SetDecision keeps the raw decision text and parses the analysis type out of it
+func (project *ProjectUpdate) SetDecision(text string) {
+	project.Decision = text
+	project.AnalysisType = parseAnalysisType(text)
+	project.ObjectionEligible = parseObjectionEligible(text, project.AnalysisType)
+	if project.AnalysisType == AnalysisUnknown && text != "" {
+		project.addIssue("decision", text, "unknown analysis type")
+	}
+}
+
+// SetExpectedImplementation keeps the raw text and parses the window out of it
+func (project *ProjectUpdate) SetExpectedImplementation(text string) {
+	project.ExpectedImplementation = text
+	window, ok := parseImplementationWindow(text)
+	project.ImplementationWindow = window
+	if !ok {
+		project.addIssue("expected_implementation", text, "unable to read the expected implementation date")
+	}
 }
 
+// SetContacts reads every contact in the cell, reporting the parts it can't
 func (project *ProjectUpdate) SetContacts(html string) {
-	contacts := strings.Split(html, "<br/>")
-	if len(contacts) != 3 {
-		log.Fatal("bad contacts")
+	contacts, problems := parseContacts(html)
+	project.Contacts = contacts
+	for _, problem := range problems {
+		project.addIssue("contact", problem[0], problem[1])
+	}
+}
+
+// SetUsfsRegion validates the region text, falling back to the
+// region of the forest the SOPA report is for. With no region text
+// and no region in the forest id the project is assumed national.
+func (project *ProjectUpdate) SetUsfsRegion(sopaReportUrl string) {
+	region, err := ParseUSFSRegion(project.Region)
+	if err == nil {
+		project.UsfsRegion = region
+		return
 	}
-	var phone_string = contacts[1]                                             // TODO phonenumbers doesnt seem to handle numbers starting with 0 well
-	phone_number, _ := phonenumbers.Parse(strings.ToLower(phone_string), "US") // format phone number, toLower catches more "ext" strings
-	formatted_number := phonenumbers.Format(phone_number, phonenumbers.NATIONAL)
-	project.Contact = Contact{
-		Name:  contacts[0],
-		Phone: formatted_number,
-		Email: contacts[2],
+
+	project.UsfsRegion = regionFromForestId(GetForestIdFromSopaReportURL(sopaReportUrl))
+	if project.UsfsRegion != RegionUnknown {
+		return
+	}
+	if project.Region == "" {
+		project.Region = string(RegionNational)
+		project.UsfsRegion = RegionNational
+		return
 	}
+	project.addIssue("region", project.Region, err.Error())
 }
 
 func (project *ProjectUpdate) SetSopaReportDateFromURL(url string) {
@@ -129,6 +194,19 @@ func GetSopaReportDateFromURL(url string) string {
 	return url[len(url)-12 : len(url)-5] // example url: https://www.fs.fed.us/sopa/components/reports/sopa-110519-2021-07.html
 }
 
+var sopaReportForestId = regexp.MustCompile(`sopa-(\d+)-\d{4}-\d{2}\.html`)
+
+// GetForestIdFromSopaReportURL returns 110519 for
+// https://www.fs.fed.us/sopa/components/reports/sopa-110519-2021-07.html
+func GetForestIdFromSopaReportURL(url string) int {
+	matches := sopaReportForestId.FindStringSubmatch(url)
+	if len(matches) != 2 {
+		return 0
+	}
+	id, _ := strconv.Atoi(matches[1])
+	return id
+}
+
 var descriptionAndLink = regexp.MustCompile("Description:(.*)Web Link:(.*)")
 var getProjectID = regexp.MustCompile(`http.*project=(\d*)`)
 
@@ -142,12 +220,44 @@ func (project *ProjectUpdate) SetDescription(text string) {
 		}
 	} else {
 		project.Description = strings.Replace(text, "Description:", "", 1)
-		project.Description = project.Description[1:] // remove first char, which isn't an ascii space
+		project.Description = trimLeadingSpace(project.Description) // first char isn't an ascii space
+		if project.Description == "" {
+			project.addIssue("description", text, "empty description")
+		}
+	}
+}
+
+func (project *ProjectUpdate) SetLocation(text string) {
+	project.Location = strings.Replace(text, "Location:", "", 1)
+	project.Location = trimLeadingSpace(project.Location) // first char isn't an ascii space
+	if project.Location == "" {
+		project.addIssue("location", text, "empty location")
+	}
+
+	location, problems := parseLocation(project.Location)
+	project.LocationDetail = location
+	for _, problem := range problems {
+		project.addIssue(problem[0], problem[1], "unable to read location section")
 	}
 }
 
+func (project *ProjectUpdate) addIssue(field string, raw string, reason string) {
+	project.Issues = append(project.Issues, ParseIssue{
+		PageUrl: project.pageUrl,
+		Row:     project.row,
+		Field:   field,
+		Raw:     raw,
+		Reason:  reason,
+	})
+}
+
 var singleSpacePattern = regexp.MustCompile(`\s+`)
 
+// trimLeadingSpace also catches the non breaking spaces USFS puts after labels
+func trimLeadingSpace(s string) string {
+	return strings.TrimLeftFunc(s, unicode.IsSpace)
+}
+
 func trim(s string) string {
 	s = strings.TrimSpace(s)
 	s = singleSpacePattern.ReplaceAllString(s, " ")
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,23 +15,19 @@ type UploadDocumentsConfig struct {
 	SecretAccessKey string `required help:"AWS Secret Access Key" type:"string"`
 	RegionId        string `required help:"AWS Region ID" type:"string"`
 	BucketName      string `required help:"S3 bucket that files will be uploaded to" type:"string"`
-	ForestDataFile  string `required help:"Forest Data JSON File" type:"path"`
+	ForestDataFile  string `required help:"Forest data file, JSON or NDJSON, optionally .gz or .zst compressed" type:"path"`
+
+	ForestFilterConfig
+	CrawlConfig
 }
 
-func UploadDocuments(config UploadDocumentsConfig) error {
+func UploadDocuments(ctx context.Context, config UploadDocumentsConfig) error {
 	/*
-		file, err := ioutil.ReadFile(config.ForestDataFile)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"file":  config.ForestDataFile,
-				"error": err.Error(),
-			}).Error("Unable to open forest data file")
-			return err
-		}
-
 		forests := []Forest{}
-
-		err = json.Unmarshal([]byte(file), &forests)
+		_, err := readDatasetFile(config.ForestDataFile, config.Selected(func(forest Forest) error {
+			forests = append(forests, forest)
+			return nil
+		}))
 		if err != nil {
 			log.WithFields(log.Fields{
 				"file":  config.ForestDataFile,
@@ -56,10 +53,14 @@ func UploadDocuments(config UploadDocumentsConfig) error {
 		}
 		s3Service := s3.New(sess, &aws.Config{})
 		uploader := s3manager.NewUploader(sess)
+		fetcher, err := NewFetcher(config.CrawlConfig)
+		if err != nil {
+			return err
+		}
 
 		// TODO
-		// for _, doc := range forests[i].Projects[j].ProjectDocuments {
-		// 	err := uploadReport(doc, project.Id, uploader, s3Service)
+		// for _, doc := range forests[i].Projects[j].Documents {
+		// 	err := uploadReport(ctx, fetcher, config.BucketName, doc, project.Id, uploader, s3Service)
 		// 	if err != nil {
 		// 		fmt.Printf("error uploading %s at %s for %s {%s}", doc.Name, doc.Url, forest.Name, err.Error())
 		// 	}
@@ -69,6 +70,8 @@ func UploadDocuments(config UploadDocumentsConfig) error {
 }
 
 func uploadReport(
+	ctx context.Context,
+	fetcher *Fetcher,
 	bucketName string,
 	doc ProjectDocument,
 	projectId string,
@@ -97,7 +100,11 @@ func uploadReport(
 		return nil
 	}
 
-	res := get(doc.Url)
+	res, err := fetcher.Download(ctx, doc.Url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
 
 	_, err = uploader.Upload(&s3manager.UploadInput{
 		Body:   res.Body,
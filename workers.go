@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+// runIndexed calls fn for every index in [0, count) using at most
+// concurrency goroutines. Callers store results by index, so the
+// output order never depends on how the work was scheduled.
+func runIndexed(concurrency int, count int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// semaphore caps work shared between runIndexed calls, so nested
+// calls don't multiply their concurrency
+type semaphore chan struct{}
+
+func newSemaphore(size int) semaphore {
+	if size < 1 {
+		size = 1
+	}
+	return make(semaphore, size)
+}
+
+func (s semaphore) acquire() {
+	s <- struct{}{}
+}
+
+func (s semaphore) release() {
+	<-s
+}